@@ -0,0 +1,86 @@
+package s3filter
+
+// Columns extracted from a batch of records, reused from batch to batch
+type columns struct {
+	ids   []int64
+	secs  []int64
+	nsecs []int32
+}
+
+// Batch evaluates criteria over batches of records a criterion at a time.
+// Each criterion runs as a tight loop over one column of the batch (ids, times, then word sets),
+// and later criteria only look at the records earlier ones kept.
+// A Batch is not safe for concurrent use; give each goroutine its own.
+type Batch struct {
+	Criteria Criteria
+	cols     columns
+}
+
+// Match sets matched[i] to whether records[i] meets every criterion; matched must be at least as long as records
+func (b *Batch) Match(records []Record, matched []bool) {
+	c := &b.Criteria
+	n := len(records)
+	matched = matched[:n]
+	for i := range matched {
+		matched[i] = true
+	}
+
+	if c.ID != 0 || len(c.IDs) > 0 {
+		ids := grow(b.cols.ids, n)
+		for i := range records {
+			ids[i] = records[i].Id
+		}
+		switch {
+		case c.ID != 0 && len(c.IDs) == 0:
+			for i, id := range ids {
+				matched[i] = id == c.ID
+			}
+		default:
+			for i, id := range ids {
+				matched[i] = c.matchesID(id)
+			}
+		}
+		b.cols.ids = ids
+	}
+
+	if !c.From.IsZero() || !c.To.IsZero() {
+		// compare times as (seconds, nanoseconds) pairs, which Time.Before and Time.After agree with
+		secs, nsecs := grow(b.cols.secs, n), grow(b.cols.nsecs, n)
+		for i := range records {
+			secs[i], nsecs[i] = records[i].Time.Unix(), int32(records[i].Time.Nanosecond())
+		}
+		if !c.From.IsZero() {
+			fromSec, fromNsec := c.From.Unix(), int32(c.From.Nanosecond())
+			for i := range secs {
+				if secs[i] < fromSec || secs[i] == fromSec && nsecs[i] < fromNsec {
+					matched[i] = false
+				}
+			}
+		}
+		if !c.To.IsZero() {
+			toSec, toNsec := c.To.Unix(), int32(c.To.Nanosecond())
+			for i := range secs {
+				if secs[i] > toSec || secs[i] == toSec && nsecs[i] > toNsec {
+					matched[i] = false
+				}
+			}
+		}
+		b.cols.secs, b.cols.nsecs = secs, nsecs
+	}
+
+	if c.Word != "" || c.WordPattern != nil || len(c.Words) > 0 || len(c.WithoutWords) > 0 {
+		for i := range records {
+			if matched[i] {
+				matched[i] = c.matchesWords(records[i].Words)
+			}
+		}
+	}
+}
+
+// Resize a column for n values, reusing its storage when it is large enough
+func grow[T any](column []T, n int) []T {
+	if cap(column) < n {
+		return make([]T, n)
+	}
+	return column[:n]
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"s3filter"
+)
+
+// Interval between Athena query status checks
+const athenaPollInterval = time.Second
+
+// Placeholder the query uses for the temporary table over the filtered output
+const recordsTable = "{{records}}"
+
+// `s3filter athena -location s3://{bucket}/{prefix} -query {sql} -output-location s3://{bucket}/{prefix}`
+// Register filtered output as a temporary Athena table, run a query against it and print the results.
+// The query refers to the table as `{{records}}`, which nothing else in SQL can be mistaken for. The table is dropped afterwards.
+func runAthena(args []string) {
+	flags := flag.NewFlagSet("athena", flag.ExitOnError)
+	location := flags.String("location", "", "An S3 URI (`s3://{bucket}/{prefix}`) of the filtered output, e.g. the `-dst` of `sync`.")
+	query := flags.String("query", "", "The SQL query to run, referring to the filtered output as `{{records}}`.")
+	outputLocation := flags.String("output-location", "", "An S3 URI (`s3://{bucket}/{prefix}`) where Athena writes query results.")
+	database := flags.String("database", "default", "The Glue database the temporary table is created in.")
+	workgroup := flags.String("workgroup", "primary", "The Athena workgroup queries run in.")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter athena -location s3://{bucket}/{prefix} -query {sql} -output-location s3://{bucket}/{prefix}")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *location == "" || *query == "" || *outputLocation == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+	S3URI = location
+	if !strings.Contains(*query, recordsTable) {
+		exitErrorf("The query does not refer to the filtered output as %s", recordsTable)
+	}
+
+	// Athena tables point at a prefix, so the location always ends in `/`
+	if _, _, err := s3filter.ParsePrefix(*location); err != nil {
+		exitErrorf("%v", err)
+	}
+	tableLocation := strings.TrimSuffix(*location, "/") + "/"
+
+	sess, err := newSession()
+	if err != nil {
+		exitErrorf("Failed to create new session. %v\n", err)
+	}
+	client := athena.New(sess)
+	run := func(sql string) (*string, error) {
+		return runAthenaQuery(client, sql, *database, *workgroup, *outputLocation)
+	}
+
+	table := fmt.Sprintf("s3filter_%d", time.Now().UnixNano())
+	ddl := fmt.Sprintf("CREATE EXTERNAL TABLE `%s` (`id` bigint, `time` string, `words` array<string>) "+
+		"ROW FORMAT SERDE 'org.openx.data.jsonserde.JsonSerDe' LOCATION '%s'", table, tableLocation)
+	if _, err = run(ddl); err != nil {
+		exitErrorf("Unable to create table over %s %v", tableLocation, err)
+	}
+	defer func() {
+		if _, err := run(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", table)); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to drop table %s: %v\n", table, err)
+		}
+	}()
+
+	id, err := run(strings.ReplaceAll(*query, recordsTable, table))
+	if err != nil {
+		exitErrorf("Query failed %v", err)
+	}
+	if err = printAthenaResults(client, id); err != nil {
+		exitErrorf("Unable to read query results %v", err)
+	}
+}
+
+// Start a query and wait until it finishes, returning its execution ID
+func runAthenaQuery(client *athena.Athena, sql, database, workgroup, outputLocation string) (*string, error) {
+	started, err := client.StartQueryExecution(&athena.StartQueryExecutionInput{
+		QueryString:           aws.String(sql),
+		QueryExecutionContext: &athena.QueryExecutionContext{Database: aws.String(database)},
+		WorkGroup:             aws.String(workgroup),
+		ResultConfiguration:   &athena.ResultConfiguration{OutputLocation: aws.String(outputLocation)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		execution, err := client.GetQueryExecution(&athena.GetQueryExecutionInput{QueryExecutionId: started.QueryExecutionId})
+		if err != nil {
+			return nil, err
+		}
+		status := execution.QueryExecution.Status
+		switch aws.StringValue(status.State) {
+		case athena.QueryExecutionStateSucceeded:
+			return started.QueryExecutionId, nil
+		case athena.QueryExecutionStateFailed, athena.QueryExecutionStateCancelled:
+			return nil, fmt.Errorf("%s: %s", aws.StringValue(status.State), aws.StringValue(status.StateChangeReason))
+		}
+		time.Sleep(athenaPollInterval)
+	}
+}
+
+// Print query results as tab separated rows, the first row being the column names
+func printAthenaResults(client *athena.Athena, id *string) error {
+	return client.GetQueryResultsPages(&athena.GetQueryResultsInput{QueryExecutionId: id},
+		func(page *athena.GetQueryResultsOutput, lastPage bool) bool {
+			for _, row := range page.ResultSet.Rows {
+				values := make([]string, len(row.Data))
+				for i, datum := range row.Data {
+					values[i] = aws.StringValue(datum.VarCharValue)
+				}
+				fmt.Fprintln(Output, strings.Join(values, "\t"))
+			}
+			return true
+		})
+}
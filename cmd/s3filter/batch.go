@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Set by `-keep-going`: object failures in multi-object runs are collected instead of aborting
+var KeepGoing *bool
+
+// Objects that failed in a `-keep-going` run
+var Failures []string
+
+// Exit code of a run in which some objects failed
+const exitPartialFailure = 2
+
+// Handle the failure of one object of a multi-object run
+func objectFailed(uri string, err error) {
+	if !*KeepGoing {
+		exitErrorf("Unable to process %s %v", uri, err)
+	}
+
+	failure := fmt.Sprintf("%s: %v", uri, err)
+	Failures = append(Failures, failure)
+	fmt.Fprintln(os.Stderr, "Failed", failure)
+}
+
+// Print the collected failures to stderr
+func reportFailures() {
+	fmt.Fprintf(os.Stderr, "%d objects failed:\n", len(Failures))
+	for _, failure := range Failures {
+		fmt.Fprintln(os.Stderr, "  "+failure)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Per-run resource ceilings from `-max-connections` and `-max-goroutines`; 0 leaves them unbounded
+var (
+	MaxConnections int
+	MaxGoroutines  int
+)
+
+// How often the goroutine count is sampled, and the share of a ceiling that is warned about
+const (
+	ceilingInterval = 500 * time.Millisecond
+	ceilingWarning  = 0.8
+)
+
+// The error of the first ceiling exceeded
+var ceilingFailed atomic.Value
+
+// HTTP client holding at most `-max-connections` connections per host; requests beyond it wait for one to be free
+func ceilingClient() *http.Client {
+	if MaxConnections <= 0 {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = MaxConnections
+	transport.MaxIdleConnsPerHost = MaxConnections
+	return &http.Client{Transport: transport}
+}
+
+// Sample the goroutine count until the run ends, warning as it nears `-max-goroutines` and failing the run beyond it
+func monitorGoroutines() {
+	if MaxGoroutines <= 0 {
+		return
+	}
+	go func() {
+		warned := false
+		for range time.Tick(ceilingInterval) {
+			n := runtime.NumGoroutine()
+			switch {
+			case n > MaxGoroutines:
+				exceedCeiling(fmt.Errorf("%d goroutines exceed -max-goroutines %d; lower -workers or -max-connections, or use -mode interactive", n, MaxGoroutines))
+				return
+			case !warned && float64(n) > ceilingWarning*float64(MaxGoroutines):
+				warned = true
+				fmt.Fprintf(os.Stderr, "Warning: %d goroutines, nearing -max-goroutines %d\n", n, MaxGoroutines)
+			}
+		}
+	}()
+}
+
+// Fail the run at the next record or object, rather than from the monitoring goroutine
+func exceedCeiling(err error) {
+	ceilingFailed.CompareAndSwap(nil, err)
+}
+
+// The error of a ceiling the run exceeded, if any
+func ceilingError() error {
+	err, _ := ceilingFailed.Load().(error)
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Rolling SHA-256 hash chain over emitted records, nil unless `-hash-chain` is set.
+// Each link is sha256(previous link || record line including its newline), starting from 32 zero bytes,
+// so the final digest changes if any record is altered, dropped, added or reordered.
+var Chain *hashChain
+
+type hashChain struct {
+	link    [sha256.Size]byte
+	records int64
+}
+
+func (c *hashChain) add(line []byte) {
+	h := sha256.New()
+	h.Write(c.link[:])
+	h.Write(line)
+	h.Write([]byte{'\n'})
+	h.Sum(c.link[:0])
+	c.records++
+}
+
+func (c *hashChain) digest() string {
+	return "sha256:" + hex.EncodeToString(c.link[:])
+}
+
+// `s3filter digest {s3://{bucket}/{key}|path|-}`
+// Recompute the hash chain digest of an extract, to compare with the one in the run summary.
+func runDigest(args []string) {
+	flags := flag.NewFlagSet("digest", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter digest {s3://{bucket}/{key}|path|-}")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	src := flags.Arg(0)
+	S3URI = &src
+	data, err := readSource(src)
+	if err != nil {
+		exitErrorf("Unable to read %s %v", src, err)
+	}
+	if data, err = inflate(data, src); err != nil {
+		exitErrorf("Unable to unzip file %v", err)
+	}
+
+	chain := &hashChain{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		chain.add(bytes.TrimSuffix(scanner.Bytes(), []byte{'\r'}))
+	}
+	if err = scanner.Err(); err != nil {
+		exitErrorf("Unable to read %s %v", src, err)
+	}
+	fmt.Printf("%d records, %s\n", chain.records, chain.digest())
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"s3filter"
+)
+
+// Repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Declarative data quality check evaluated over every scanned record.
+// Supported forms:
+//
+//	{field} not null
+//	{field} between {low} and {high}   (numbers, or times as `-from-time` and `-to-time` take them)
+//	unique {field}
+type Check struct {
+	Expr     string
+	Failures int64
+
+	field string
+	kind  string
+	low   interface{}
+	high  interface{}
+	seen  map[string]struct{}
+}
+
+// Parse a `-check` expression, with relative times resolved against now
+func parseCheck(expr string, now time.Time) (*Check, error) {
+	words := strings.Fields(expr)
+	check := &Check{Expr: expr}
+
+	switch {
+	case len(words) == 2 && words[0] == "unique":
+		check.kind = "unique"
+		check.field = words[1]
+		check.seen = make(map[string]struct{})
+	case len(words) == 3 && words[1] == "not" && words[2] == "null":
+		check.kind = "not null"
+		check.field = words[0]
+	case len(words) == 5 && words[1] == "between" && words[3] == "and":
+		check.kind = "between"
+		check.field = words[0]
+		var err error
+		if check.low, err = check.bound(words[2], now, false); err != nil {
+			return nil, err
+		}
+		if check.high, err = check.bound(words[4], now, true); err != nil {
+			return nil, err
+		}
+		if fmt.Sprintf("%T", check.low) != fmt.Sprintf("%T", check.high) {
+			return nil, fmt.Errorf("the bounds of check %q are not both numbers or both times", expr)
+		}
+	default:
+		return nil, fmt.Errorf("unable to parse check %q", expr)
+	}
+	return check, nil
+}
+
+// Parse a `between` bound as a number or a point in time; a date as the high bound covers the whole day, as with `-to-time`
+func (c *Check) bound(s string, now time.Time, end bool) (interface{}, error) {
+	// exact, like the json.Number values compared with it; NaN is rejected
+	if n, ok := s3filter.NumberValue(json.Number(s)); ok {
+		return n, nil
+	}
+	if t, err := parseTimeExpr(s, now, end); err == nil {
+		return t, nil
+	}
+	return nil, fmt.Errorf("invalid bound %q in check %q", s, c.Expr)
+}
+
+// Evaluate the check against one decoded record
+func (c *Check) eval(doc map[string]interface{}) {
+	value, present := doc[c.field]
+
+	switch c.kind {
+	case "not null":
+		if !present || value == nil {
+			c.Failures++
+		}
+	case "unique":
+		key, _ := json.Marshal(value)
+		if _, dup := c.seen[string(key)]; dup {
+			c.Failures++
+			return
+		}
+		c.seen[string(key)] = struct{}{}
+	case "between":
+		if !c.within(value) {
+			c.Failures++
+		}
+	}
+}
+
+func (c *Check) within(value interface{}) bool {
+	switch low := c.low.(type) {
+	case *big.Float:
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		n, ok := s3filter.NumberValue(number)
+		return ok && n.Cmp(low) >= 0 && n.Cmp(c.high.(*big.Float)) <= 0
+	case time.Time:
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return false
+		}
+		high, ok := c.high.(time.Time)
+		return ok && !t.Before(low) && !t.After(high)
+	}
+	return false
+}
+
+// Evaluate all checks against a raw record
+func runChecks(checks []*Check, raw []byte) error {
+	var doc map[string]interface{}
+	if err := s3filter.DecodeValue(raw, &doc); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		check.eval(doc)
+	}
+	return nil
+}
+
+// Print the pass/fail report to stderr and report whether every check passed
+func reportChecks(checks []*Check) bool {
+	passed := true
+	fmt.Fprintln(os.Stderr, "Data quality checks:")
+	for _, check := range checks {
+		if check.Failures == 0 {
+			fmt.Fprintf(os.Stderr, "  PASS %s\n", check.Expr)
+			continue
+		}
+		passed = false
+		fmt.Fprintf(os.Stderr, "  FAIL %s (%d records)\n", check.Expr, check.Failures)
+	}
+	return passed
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCheck(t *testing.T) {
+	for _, expr := range []string{
+		"id not null",
+		"unique id",
+		"id between 0 and 10",
+		"time between 2024-01-01 and now",
+		"time between 2024-01-01T00:00:00Z and 2024-12-31",
+		"time between now-7d and now+1h",
+		"time between -24h and now",
+	} {
+		if _, err := parseCheck(expr, time.Now()); err != nil {
+			t.Errorf("%s: %v", expr, err)
+		}
+	}
+	for _, expr := range []string{
+		"id between 0 and now",
+		"time between 2024-01-01 and 5",
+		"id between 0 and x",
+		"id between 0",
+		"id is null",
+	} {
+		if _, err := parseCheck(expr, time.Now()); err == nil {
+			t.Errorf("%s parsed", expr)
+		}
+	}
+}
+
+func TestCheckBetween(t *testing.T) {
+	for _, test := range []struct {
+		expr, doc string
+		failures  int64
+	}{
+		{"id between 9007199254740993 and 9007199254740993", `{"id": 9007199254740993}`, 0},
+		{"id between 9007199254740993 and 9007199254740993", `{"id": 9007199254740992}`, 1},
+		{"x between 0.1 and 0.3", `{"x": 0.30000000000000001}`, 1},
+		{"x between -Inf and 5", `{"x": -1e300}`, 0},
+		{"x between 0 and 5", `{"x": "3"}`, 1},
+		{"time between 2024-01-01 and 2024-01-02", `{"time": "2024-01-01T12:00:00Z"}`, 0},
+		{"time between 2024-01-01 and 2024-01-02", `{"time": 5}`, 1},
+		{"time between 2024-01-01 and 2024-01-01", `{"time": "2024-01-01T23:59:59Z"}`, 0},
+		{"time between 2024-01-01 and 2024-01-01", `{"time": "2024-01-02T00:00:00Z"}`, 1},
+	} {
+		check, err := parseCheck(test.expr, time.Now())
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+		if err = runChecks([]*Check{check}, []byte(test.doc)); err != nil {
+			t.Fatal(err)
+		}
+		if check.Failures != test.failures {
+			t.Errorf("%s on %s: %d failures, want %d", test.expr, test.doc, check.Failures, test.failures)
+		}
+	}
+	for _, expr := range []string{"x between NaN and 5", "x between 0 and nan"} {
+		if _, err := parseCheck(expr, time.Now()); err == nil {
+			t.Errorf("%s parsed", expr)
+		}
+	}
+}
+
+// Relative bounds are resolved against `-now`, as `-from-time` and `-to-time` are
+func TestCheckNow(t *testing.T) {
+	src := `{"id":1,"time":"2024-06-01T12:00:00Z"}` + "\n"
+	for _, test := range []struct {
+		now      string
+		failures int64
+	}{
+		{"2024-06-01T13:00:00Z", 0},
+		{"2024-06-09T13:00:00Z", 1},
+		{"2024-06-01T11:00:00Z", 1},
+	} {
+		runFilter(t, "", "-now", test.now, "-check", "time between now-7d and now", "-count")
+		if err := filter(strings.NewReader(src)); err != nil {
+			t.Fatal(err)
+		}
+		if got := Checks[0].Failures; got != test.failures {
+			t.Errorf("-now %s: %d failures, want %d", test.now, got, test.failures)
+		}
+	}
+}
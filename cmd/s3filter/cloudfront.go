@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+)
+
+// Set by `-cloudfront-key-pair-id`, `-cloudfront-private-key`, `-cloudfront-sign` and `-cloudfront-expiry`:
+// how https:// inputs served by a CloudFront distribution restricted to signed viewers are signed
+var (
+	CloudFrontKeyID  string
+	CloudFrontKey    *rsa.PrivateKey
+	CloudFrontSign   = "url"
+	CloudFrontExpiry = time.Hour
+)
+
+// Reads of a URL that fail midway are resumed with a Range request this many times
+const resumeAttempts = 3
+
+// Report whether an input is a URL read over HTTP rather than an S3 URI
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "https://") || strings.HasPrefix(input, "http://")
+}
+
+// Sign a request to a distribution with a canned policy, as query parameters or as cookies
+func signRequest(req *http.Request) error {
+	if CloudFrontKey == nil {
+		return nil
+	}
+	expires := time.Now().Add(CloudFrontExpiry)
+	if CloudFrontSign == "cookie" {
+		cookies, err := sign.NewCookieSigner(CloudFrontKeyID, CloudFrontKey).Sign(req.URL.String(), expires)
+		if err != nil {
+			return err
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return nil
+	}
+	signed, err := sign.NewURLSigner(CloudFrontKeyID, CloudFrontKey).Sign(req.URL.String(), expires)
+	if err != nil {
+		return err
+	}
+	req.URL, err = url.Parse(signed)
+	return err
+}
+
+// The name decompression is detected from, the path of the URL without its query
+func urlName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return rawURL
+}
+
+// Open a URL as a single stream, within `-object-timeout` and `-stall-timeout`;
+// a read failing midway is resumed from where it stopped with a Range request
+func openURL(rawURL string) (io.ReadCloser, error) {
+	return transfer().Watch(context.Background(), func(ctx context.Context) (io.ReadCloser, error) {
+		r := &urlReader{ctx: ctx, url: rawURL}
+		if err := r.open(); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
+}
+
+// Body of a URL, reopened at the offset read so far when the connection fails
+type urlReader struct {
+	ctx     context.Context
+	url     string
+	body    io.ReadCloser
+	offset  int64
+	etag    string // of the first response, so a resumed read fails rather than mixing versions
+	resumed int
+}
+
+func (r *urlReader) open() error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		if r.etag != "" {
+			req.Header.Set("If-Range", r.etag)
+		}
+	}
+	if err = signRequest(req); err != nil {
+		return fmt.Errorf("unable to sign %s: %v", r.url, err)
+	}
+	client := ceilingClient()
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case r.offset == 0 && resp.StatusCode == http.StatusOK:
+		r.etag = resp.Header.Get("ETag")
+	case r.offset > 0 && resp.StatusCode == http.StatusPartialContent:
+	case r.offset > 0 && resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return fmt.Errorf("%s changed or does not support Range requests, unable to resume at byte %d", r.url, r.offset)
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("GET %s: %s", r.url, resp.Status)
+	}
+	if Tracker != nil && r.offset == 0 && resp.ContentLength >= 0 {
+		Tracker.begin(r.url, resp.ContentLength)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *urlReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if Tracker != nil {
+		Tracker.add(int64(n))
+	}
+	if err == nil || err == io.EOF || r.ctx.Err() != nil || r.resumed == resumeAttempts {
+		return n, err
+	}
+	r.resumed++
+	incident("Read of %s failed at byte %d (%v), resuming (attempt %d)", r.url, r.offset, err, r.resumed+1)
+	r.body.Close()
+	if err = r.open(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (r *urlReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+// ANSI styles used by `-color`
+const (
+	colorReset   = "\033[0m"
+	colorKey     = "\033[34m"
+	colorString  = "\033[32m"
+	colorNumber  = "\033[33m"
+	colorLiteral = "\033[35m"
+	colorMatch   = "\033[1;30;43m"
+)
+
+// Whether matches are syntax highlighted, resolved from `-color`
+var Colorize bool
+
+// Resolve `-color` (`auto`, `always` or `never`); `auto` colors only when stdout is a terminal
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Syntax highlight compact JSON, marking string values equal to one of words
+func highlight(doc []byte, words []string) []byte {
+	var matches [][]byte
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		if encoded, err := json.Marshal(word); err == nil {
+			matches = append(matches, encoded)
+		}
+	}
+
+	var out bytes.Buffer
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(doc) && doc[end] != '"' {
+				if doc[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			if end > len(doc) {
+				end = len(doc)
+			}
+			token := doc[i:end]
+
+			style := colorString
+			if end < len(doc) && doc[end] == ':' {
+				style = colorKey
+			} else {
+				for _, match := range matches {
+					if bytes.Equal(token, match) {
+						style = colorMatch
+						break
+					}
+				}
+			}
+			out.WriteString(style)
+			out.Write(token)
+			out.WriteString(colorReset)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i
+			for end < len(doc) && bytes.IndexByte([]byte("+-.0123456789eE"), doc[end]) >= 0 {
+				end++
+			}
+			out.WriteString(colorNumber)
+			out.Write(doc[i:end])
+			out.WriteString(colorReset)
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i
+			for end < len(doc) && doc[end] >= 'a' && doc[end] <= 'z' {
+				end++
+			}
+			out.WriteString(colorLiteral)
+			out.Write(doc[i:end])
+			out.WriteString(colorReset)
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes()
+}
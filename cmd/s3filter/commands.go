@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"s3filter"
+)
+
+// `s3filter get s3://{bucket}/{key} [path]`
+// Download an object with the tuned concurrent downloader to a local path (or into a local directory), or to stdout when path is omitted or `-`.
+func runGet(args []string) {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter get s3://{bucket}/{key} [target]")
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	uri := flags.Arg(0)
+	S3URI = &uri
+	bucket, key, err := s3filter.ParseURI(uri)
+	if err != nil {
+		exitErrorf("%v", err)
+	}
+
+	sess, err := newSession()
+	if err != nil {
+		exitErrorf("Failed to create new session. %v\n", err)
+	}
+
+	target := flags.Arg(1)
+	if target == "" || target == "-" {
+		data, err := download(sess, bucket, key)
+		if err != nil {
+			exitErrorf("Unable to download file %v", err)
+		}
+		if _, err = os.Stdout.Write(data); err != nil {
+			exitErrorf("Unable to write output %v", err)
+		}
+		return
+	}
+
+	// A local directory keeps the object name
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		target = filepath.Join(target, path.Base(key))
+	}
+
+	// Parts are written straight into the file at their offsets
+	file, err := os.Create(target)
+	if err != nil {
+		exitErrorf("Unable to create %s %v", target, err)
+	}
+	defer file.Close()
+
+	if s3filter.IsObjectLambda(bucket) {
+		stream, err := openObject(sess, bucket, key, 0)
+		if err == nil {
+			_, err = io.Copy(file, stream)
+			stream.Close()
+		}
+		if err != nil {
+			exitErrorf("Unable to download file %v", err)
+		}
+		return
+	}
+
+	_, err = s3filter.NewDownloader(sess, sizeDownloader).Download(file, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		exitErrorf("Unable to download file %v", err)
+	}
+}
+
+// `s3filter decompress {s3://{bucket}/{key}|path|-} [path]`
+// Decompress a gzip (or `.zst` zstd) S3 object, local file or stdin to a local path, or to stdout when path is omitted or `-`.
+func runDecompress(args []string) {
+	flags := flag.NewFlagSet("decompress", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter decompress {s3://{bucket}/{key}|path|-} [path]")
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	src := flags.Arg(0)
+	S3URI = &src
+	data, err := readSource(src)
+	if err != nil {
+		exitErrorf("Unable to read %s %v", src, err)
+	}
+
+	plain, err := inflate(data, src)
+	if err != nil {
+		exitErrorf("Unable to unzip file %v", err)
+	}
+
+	if err = writeDestination(flags.Arg(1), plain); err != nil {
+		exitErrorf("Unable to write output %v", err)
+	}
+}
+
+// Read an S3 object, a local file or stdin (`-`)
+func readSource(src string) ([]byte, error) {
+	switch {
+	case src == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(src, "s3://"):
+		bucket, key, err := s3filter.ParseURI(src)
+		if err != nil {
+			return nil, err
+		}
+		sess, err := newSession()
+		if err != nil {
+			return nil, err
+		}
+		return download(sess, bucket, key)
+	}
+	return os.ReadFile(src)
+}
+
+// Write data to a local path, or to stdout when path is empty or `-`
+func writeDestination(path string, data []byte) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// `s3filter put [flags] {path|-} s3://{bucket}/{key}`
+// A destination ending in `/` keeps the local file name.
+// Filter and validate records of a local file or stdin with the usual flags, then upload the result
+// with a multipart upload, compressed as `-output-compression` says or by default as the key ends in `.gz` or `.zst`.
+func runPut(args []string) {
+	flags := flag.NewFlagSet("put", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter put [flags] {path|-} s3://{bucket}/{key}")
+		flags.PrintDefaults()
+	}
+	processArgs(flags, args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	start := time.Now()
+
+	src, dst := flags.Arg(0), flags.Arg(1)
+	// A destination prefix keeps the local file name, whatever the platform's path separator
+	if strings.HasSuffix(dst, "/") && src != "-" {
+		dst += filepath.Base(src)
+	}
+	S3URI = &dst
+	bucket, key, err := s3filter.ParseURI(dst)
+	if err != nil {
+		exitErrorf("%v", err)
+	}
+
+	data, err := readSource(src)
+	if err != nil {
+		exitErrorf("Unable to read %s %v", src, err)
+	}
+	if data, err = inflate(data, src); err != nil {
+		exitErrorf("Unable to unzip file %v", err)
+	}
+	text, err := s3filter.DecodeText(bytes.NewReader(data), *Encoding)
+	if err != nil {
+		exitErrorf("Unable to decode text %v", err)
+	}
+
+	sess, err := newSession()
+	if err != nil {
+		exitErrorf("Failed to create new session. %v\n", err)
+	}
+
+	err = uploadFiltered(sess, text, &s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, false)
+	if err != nil {
+		exitErrorf("Unable to upload file %v", err)
+	}
+
+	report(start)
+}
+
+// Filter records into the body of a multipart upload, compressed like an `-output` of the destination key.
+// A staged upload only gets the `-output-tag` tags; the other `-output-*` settings are applied by publishObject.
+func uploadFiltered(sess *session.Session, records io.Reader, input *s3manager.UploadInput, staged bool) error {
+	compression, err := outputCompression(aws.StringValue(input.Key))
+	if err != nil {
+		return err
+	}
+	client := s3.New(sess)
+	if err := classifyUpload(input); err != nil {
+		return err
+	}
+	if staged {
+		// the retention, storage class and ACL are applied when the object is published
+		input.StorageClass = nil
+	} else {
+		if err := lockUpload(client, input); err != nil {
+			return err
+		}
+		if err := grantUpload(client, input); err != nil {
+			return err
+		}
+		preflightOutput(sess, client, aws.StringValue(input.Bucket), aws.StringValue(input.ACL))
+	}
+
+	reader, writer := io.Pipe()
+	out, err := compressOutput(writer, compression, false)
+	if err != nil {
+		return err
+	}
+	go func() {
+		Output = out
+		err := filter(records)
+		if err == nil {
+			err = flushPick()
+		}
+		if err == nil {
+			// completes the compressed stream and the body
+			err = out.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	input.Body = reader
+	_, err = s3manager.NewUploader(sess).Upload(input)
+	reader.Close()
+	if err != nil {
+		return explainLocked(client, aws.StringValue(input.Bucket), aws.StringValue(input.Key), err)
+	}
+	return nil
+}
+
+// `s3filter copy [flags] -src s3://{bucket}/{key} -dst s3://{bucket}/{key}`
+// Read, filter, recompress and write an object in one pass, preserving its metadata and tags.
+// A destination ending in `/` keeps the source object name.
+func runCopy(args []string) {
+	flags := flag.NewFlagSet("copy", flag.ExitOnError)
+	src := flags.String("src", "", "An S3 URI (`s3://{bucket}/{key}`) of the source object.")
+	dst := flags.String("dst", "", "An S3 URI (`s3://{bucket}/{key}`) of the destination object.")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter copy [flags] -src s3://{bucket}/{key} -dst s3://{bucket}/{key}")
+		flags.PrintDefaults()
+	}
+	processArgs(flags, args)
+	if *src == "" || *dst == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+	start := time.Now()
+	S3URI = src
+
+	sess, err := newSession()
+	if err != nil {
+		exitErrorf("Failed to create new session. %v\n", err)
+	}
+
+	if err = copyObject(sess, *src, *dst, false); err != nil {
+		exitErrorf("Unable to copy %s %v", *src, err)
+	}
+
+	report(start)
+}
+
+// Filter one source object into the destination, preserving metadata and tags.
+// A staged destination is published later by publishObject.
+func copyObject(sess *session.Session, src string, dst string, staged bool) error {
+	srcBucket, srcKey, err := s3filter.ParseURI(src)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(dst, "/") {
+		dst += path.Base(srcKey)
+	}
+	dstBucket, dstKey, err := s3filter.ParseURI(dst)
+	if err != nil {
+		return err
+	}
+
+	client := s3.New(sess)
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return err
+	}
+	tagging, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The source streams through the filter into the upload, so neither object is held in memory
+	stream, err := transfer().Open(context.Background(), sess, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	reader, err := decompressStream(stream, srcKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	text, err := s3filter.DecodeText(reader, *Encoding)
+	if err != nil {
+		return err
+	}
+
+	tags := url.Values{}
+	for _, tag := range tagging.TagSet {
+		tags.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+
+	// Record the source ETag and criteria so `sync` can skip objects already filtered the same way
+	metadata := map[string]*string{sourceETagKey: head.ETag, criteriaKey: aws.String(CriteriaDigest)}
+	for name, value := range head.Metadata {
+		if !strings.EqualFold(name, sourceETagKey) && !strings.EqualFold(name, criteriaKey) {
+			metadata[name] = value
+		}
+	}
+
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(dstBucket),
+		Key:         aws.String(dstKey),
+		ContentType: head.ContentType,
+		Metadata:    metadata,
+	}
+	if len(tags) > 0 {
+		input.Tagging = aws.String(tags.Encode())
+	}
+	return uploadFiltered(sess, text, input, staged)
+}
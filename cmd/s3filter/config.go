@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"s3filter"
+)
+
+// Flags about the run itself rather than what it does, left out of the effective configuration
+var runFlags = map[string]bool{"help-format": true, "config-json": true, "print-effective-config": true}
+
+// AWS settings taken from the environment, echoed with the flags
+var configEnv = []string{"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_PROFILE"}
+
+// Apply the flags and AWS environment of a configuration printed by `-print-effective-config`.
+// Flags given on the command line and variables already set take precedence; repeatable flags take a JSON array.
+func applyConfig(flags *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config struct {
+		Flags map[string]interface{} `json:"flags"`
+		Env   map[string]string      `json:"env"`
+	}
+	if err = s3filter.DecodeValue(data, &config); err != nil {
+		return fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name, value := range config.Flags {
+		if flags.Lookup(name) == nil || runFlags[name] {
+			return fmt.Errorf("%s: unknown flag -%s", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		values, repeated := value.([]interface{})
+		if !repeated {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			if err = flags.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: -%s: %v", path, name, err)
+			}
+		}
+	}
+
+	for _, name := range configEnv {
+		if value, ok := config.Env[name]; ok && os.Getenv(name) == "" {
+			os.Setenv(name, value)
+		}
+	}
+	return nil
+}
+
+// Print every flag value, defaults included, and the AWS environment as JSON on stderr, in the form `-config-json` reads back.
+// `-now` is printed as the time relative times were resolved against, so a replay resolves them the same way.
+func printEffectiveConfig(flags *flag.FlagSet, now time.Time) error {
+	values := map[string]interface{}{}
+	flags.VisitAll(func(f *flag.Flag) {
+		if runFlags[f.Name] {
+			return
+		}
+		values[f.Name] = flagValue(f)
+	})
+	values["now"] = now.Format(time.RFC3339Nano)
+	env := map[string]string{}
+	for _, name := range configEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+
+	data, err := json.MarshalIndent(map[string]interface{}{"flags": values, "env": env}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stderr, string(data))
+	return err
+}
+
+// The value of a flag as printed: a list for repeatable flags, otherwise its text
+func flagValue(f *flag.Flag) interface{} {
+	if list, ok := f.Value.(*stringList); ok {
+		return append([]string{}, *list...)
+	}
+	return f.Value.String()
+}
@@ -0,0 +1,38 @@
+package main
+
+// Non-matching records emitted around matches by `-context`, like `grep -C`
+type contextWindow struct {
+	size   int
+	before []Record
+	after  int
+}
+
+var contextAnnotation = map[string]interface{}{"_context": true}
+
+// Handle a record that didn't match: emit it if it follows a recent match,
+// otherwise remember it in case a match follows.
+func (c *contextWindow) skip(record Record) error {
+	if c.after > 0 {
+		c.after--
+		return emit(record, contextAnnotation)
+	}
+
+	c.before = append(c.before, record)
+	if len(c.before) > c.size {
+		c.before = c.before[1:]
+	}
+	return nil
+}
+
+// Handle a match: emit the remembered records preceding it
+// and start counting the records following it.
+func (c *contextWindow) match() error {
+	for _, record := range c.before {
+		if err := emit(record, contextAnnotation); err != nil {
+			return err
+		}
+	}
+	c.before = c.before[:0]
+	c.after = c.size
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Unit prices in USD used by `-cost-report`, overridable with `-cost-prices`
+type Prices struct {
+	GetPer1000    float64 `json:"get_per_1000"`    // GET, HEAD, SELECT and other read requests
+	PutPer1000    float64 `json:"put_per_1000"`    // PUT, COPY, POST and LIST requests
+	TransferPerGB float64 `json:"transfer_per_gb"` // data transfer out; 0 when running in the bucket's region
+	ScannedPerGB  float64 `json:"scanned_per_gb"`  // S3 Select data scanned
+	ReturnedPerGB float64 `json:"returned_per_gb"` // S3 Select data returned
+	KMSPer10000   float64 `json:"kms_per_10000"`   // KMS decrypt calls S3 makes for SSE-KMS objects without a bucket key
+}
+
+// S3 Standard list prices in us-east-1, with transfer out to the internet
+var defaultPrices = Prices{
+	GetPer1000:    0.0004,
+	PutPer1000:    0.005,
+	TransferPerGB: 0.09,
+	ScannedPerGB:  0.002,
+	ReturnedPerGB: 0.0007,
+	KMSPer10000:   0.03,
+}
+
+// Billable usage of the run, counted when `-cost-report` is set
+type usage struct {
+	gets, puts  int64
+	transferred int64
+	scanned     int64
+	returned    int64
+	kms         int64
+}
+
+var (
+	Usage     *usage
+	CostTable = defaultPrices
+)
+
+// Load a price file, keeping the default of any price it leaves out
+func loadPrices(path string) (Prices, error) {
+	prices := defaultPrices
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return prices, err
+	}
+	if err = json.Unmarshal(data, &prices); err != nil {
+		return prices, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return prices, nil
+}
+
+// Count the requests, bytes and KMS calls of every completed S3 request
+var meterRequests = request.NamedHandler{
+	Name: "s3filter.MeterRequests",
+	Fn: func(r *request.Request) {
+		if Usage == nil || r.ClientInfo.ServiceName != s3.ServiceName || r.HTTPResponse == nil {
+			return
+		}
+		switch r.Operation.Name {
+		case "PutObject", "CopyObject", "UploadPart", "UploadPartCopy", "CreateMultipartUpload", "CompleteMultipartUpload",
+			"ListObjects", "ListObjectsV2", "ListBuckets", "PutObjectTagging", "PutObjectRetention", "PutObjectLegalHold":
+			atomic.AddInt64(&Usage.puts, 1)
+		default:
+			atomic.AddInt64(&Usage.gets, 1)
+		}
+		if r.Operation.Name == "GetObject" && r.HTTPResponse.ContentLength > 0 {
+			atomic.AddInt64(&Usage.transferred, r.HTTPResponse.ContentLength)
+		}
+		if r.Operation.Name == "GetObject" || r.Operation.Name == "SelectObjectContent" {
+			header := r.HTTPResponse.Header
+			if header.Get("X-Amz-Server-Side-Encryption") == "aws:kms" && header.Get("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled") != "true" {
+				atomic.AddInt64(&Usage.kms, 1)
+			}
+		}
+	},
+}
+
+// Count the bytes an S3 Select request scanned and returned
+func meterSelect(stats *s3.Stats) {
+	if Usage == nil || stats == nil {
+		return
+	}
+	if stats.BytesScanned != nil {
+		atomic.AddInt64(&Usage.scanned, *stats.BytesScanned)
+	}
+	if stats.BytesReturned != nil {
+		atomic.AddInt64(&Usage.returned, *stats.BytesReturned)
+		atomic.AddInt64(&Usage.transferred, *stats.BytesReturned)
+	}
+}
+
+// Estimate the cost of the usage in USD
+func (u *usage) cost(p Prices) float64 {
+	const gb = 1 << 30
+	return float64(u.gets)/1000*p.GetPer1000 +
+		float64(u.puts)/1000*p.PutPer1000 +
+		float64(u.transferred)/gb*p.TransferPerGB +
+		float64(u.scanned)/gb*p.ScannedPerGB +
+		float64(u.returned)/gb*p.ReturnedPerGB +
+		float64(u.kms)/10000*p.KMSPer10000
+}
+
+// One line breakdown of the usage and its estimated cost
+func (u *usage) String() string {
+	const gb = 1 << 30
+	return fmt.Sprintf("Estimated cost: $%.4f (%d GET, %d PUT/LIST requests, %.3f GB transferred, %.3f GB scanned by S3 Select, %d KMS calls)",
+		u.cost(CostTable), u.gets, u.puts, float64(u.transferred)/gb, float64(u.scanned)/gb, u.kms)
+}
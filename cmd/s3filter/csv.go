@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Set by `-format`: `ndjson` (default), `csv` or `tsv`
+var Format *string
+
+// Columns mapped onto the record fields by `-id-column`, `-time-column` and `-words-column`
+type columnMapping struct {
+	id, time, words string
+	separator       string // splits the words column, `-words-separator`
+}
+
+var Columns columnMapping
+
+// Read delimited rows with a header and hand each one on as an NDJSON record, so every filter applies unchanged.
+// Columns missing from the header leave their field unset; a non-numeric id is kept as a string,
+// which leaves the record's `id` unset like any other document whose id is not a number.
+func delimitedRecords(src io.Reader, comma rune) func() (json.RawMessage, int64, error) {
+	reader := csv.NewReader(src)
+	reader.Comma = comma
+	reader.ReuseRecord = true
+
+	var id, at, words = -1, -1, -1
+	var header error
+	first := true
+	return func() (json.RawMessage, int64, error) {
+		if first {
+			first = false
+			names, err := reader.Read()
+			if err != nil {
+				header = fmt.Errorf("unable to read header row: %w", err)
+			}
+			for i, name := range names {
+				switch strings.TrimSpace(name) {
+				case Columns.id:
+					id = i
+				case Columns.time:
+					at = i
+				case Columns.words:
+					words = i
+				}
+			}
+			if err == nil && id < 0 && at < 0 && words < 0 {
+				header = fmt.Errorf("header row has none of the columns %q, %q or %q", Columns.id, Columns.time, Columns.words)
+			}
+		}
+		if header != nil {
+			return nil, 0, header
+		}
+
+		offset := reader.InputOffset()
+		row, err := reader.Read()
+		if err != nil {
+			return nil, offset, err
+		}
+
+		document := map[string]interface{}{}
+		if value := column(row, id); value != "" {
+			if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+				document["id"] = json.Number(value)
+			} else {
+				document["id"] = value
+			}
+		}
+		if value := column(row, at); value != "" {
+			document["time"] = value
+		}
+		if value := column(row, words); value != "" {
+			var list []string
+			for _, word := range strings.Split(value, Columns.separator) {
+				if word = strings.TrimSpace(word); word != "" {
+					list = append(list, word)
+				}
+			}
+			document["words"] = list
+		}
+		raw, err := json.Marshal(document)
+		return raw, offset, err
+	}
+}
+
+func column(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
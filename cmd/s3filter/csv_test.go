@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDelimitedRecords(t *testing.T) {
+	defer func(columns columnMapping) { Columns = columns }(Columns)
+	Columns = columnMapping{id: "id", time: "time", words: "words", separator: " "}
+	for _, test := range []struct {
+		src     string
+		comma   rune
+		want    []string
+		offsets []int64
+	}{
+		{"id,time,words\n7,2024-03-01T10:00:00Z,error disk\n", ',',
+			[]string{`{"id":7,"time":"2024-03-01T10:00:00Z","words":["error","disk"]}`}, []int64{14}},
+		// columns in any order, among others, and header names trimmed
+		{"note, words ,id\nx,a,1\ny,,2\n", ',', []string{`{"id":1,"words":["a"]}`, `{"id":2}`}, []int64{16, 22}},
+		// a non-numeric id is kept as a string, and missing columns leave their field unset
+		{"id\tother\nabc\tz\n\t\n", '\t', []string{`{"id":"abc"}`, `{}`}, []int64{9, 15}},
+		// rows must have as many fields as the header
+		{"id,words\n1\n", ',', []string{"error"}, nil},
+		// quoted fields keep their delimiters, and blank words are dropped
+		{`id,words` + "\n" + `3,"a,b  c "` + "\n", ',', []string{`{"id":3,"words":["a,b","c"]}`}, []int64{9}},
+	} {
+		next := delimitedRecords(strings.NewReader(test.src), test.comma)
+		var got []string
+		var offsets []int64
+		for {
+			raw, offset, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				got = append(got, "error")
+				break
+			}
+			got = append(got, string(raw))
+			offsets = append(offsets, offset)
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") || len(offsets) != len(test.offsets) {
+			t.Errorf("%q: got %q, want %q", test.src, got, test.want)
+			continue
+		}
+		for i := range offsets {
+			if offsets[i] != test.offsets[i] {
+				t.Errorf("%q: record %d at offset %d, want %d", test.src, i+1, offsets[i], test.offsets[i])
+			}
+		}
+	}
+}
+
+func TestDelimitedRecordsHeader(t *testing.T) {
+	defer func(columns columnMapping) { Columns = columns }(Columns)
+	Columns = columnMapping{id: "id", time: "time", words: "words", separator: " "}
+	for _, src := range []string{"", "name,size\nx,1\n", "\"id\n"} {
+		next := delimitedRecords(strings.NewReader(src), ',')
+		for i := 0; i < 2; i++ {
+			if _, _, err := next(); err == nil || err == io.EOF || !strings.Contains(err.Error(), "header row") {
+				t.Errorf("%q: call %d got %v, want a header error", src, i+1, err)
+			}
+		}
+	}
+}
+
+func TestFormatCSV(t *testing.T) {
+	src := "ts;id;tags\n2024-03-01T10:00:00Z;1;error|disk\n2024-03-01T11:00:00Z;2;info\n"
+	got := runFilter(t, strings.ReplaceAll(src, ";", "\t"), "-format", "tsv", "-time-column", "ts",
+		"-words-column", "tags", "-words-separator", "|", "-with-word", "disk")
+	if want := `{"id":1,"time":"2024-03-01T10:00:00Z","words":["error","disk"]}` + "\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
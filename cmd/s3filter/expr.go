@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/interpreter"
+	"s3filter"
+)
+
+// Set by `-expr`: a CEL (https://cel.dev) boolean expression over the fields of a record's document, e.g.
+//
+//	id > 100 && time >= "2024-01-01T00:00:00Z" && ("error" in words || user.name.matches("^svc-"))
+//
+// The top-level fields of the document are its variables. Numbers are ints when integral and doubles otherwise,
+// and compare with each other by value; strings compare lexically, or as times through timestamp().
+// A record the expression fails on, e.g. because a field it refers to is missing, or for which it isn't
+// a boolean, is malformed and handled according to `-on-malformed`.
+var Expr *expression
+
+// A compiled `-expr`
+type expression struct {
+	program  cel.Program
+	fields   map[string]int     // the index of each referenced field in pointers
+	pointers *s3filter.Pointers // the fields the expression refers to, extracted from each document
+}
+
+// Compile an `-expr`
+func compileExpr(source string) (*expression, error) {
+	env, err := cel.NewEnv(cel.CrossTypeNumericComparisons(true))
+	if err != nil {
+		return nil, err
+	}
+	parsed, issues := env.Parse(source)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	// the fields of a record are only known once it is read, so the expression isn't type checked
+	program, err := env.Program(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &expression{program: program, fields: map[string]int{}}
+	var paths [][]string
+	ast.PreOrderVisit(parsed.NativeRep().Expr(), ast.NewExprVisitor(func(node ast.Expr) {
+		if node.Kind() != ast.IdentKind {
+			return
+		}
+		if _, seen := e.fields[node.AsIdent()]; !seen {
+			e.fields[node.AsIdent()] = len(paths)
+			paths = append(paths, []string{node.AsIdent()})
+		}
+	}))
+	e.pointers = s3filter.NewPointers(paths)
+	return e, nil
+}
+
+// Report whether the expression holds for a record's document
+func (e *expression) matches(record Record) (bool, error) {
+	raw, err := e.pointers.Extract(record.Raw)
+	if err != nil {
+		return false, err
+	}
+	env := &exprEnv{fields: e.fields, raw: raw, values: make([]interface{}, len(raw))}
+	result, _, err := e.program.Eval(env)
+	if err != nil {
+		return false, fmt.Errorf("-expr: %v", err)
+	}
+	matched, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("-expr is %v, not a boolean", result.Value())
+	}
+	return matched, nil
+}
+
+// Report whether a record satisfies the `-expr`, if any
+func exprMatches(record Record) (bool, error) {
+	if Expr == nil {
+		return true, nil
+	}
+	return Expr.matches(record)
+}
+
+// The values of the referenced fields of one document, decoded on first use
+type exprEnv struct {
+	fields map[string]int
+	raw    [][]byte
+	values []interface{}
+}
+
+func (env *exprEnv) ResolveName(name string) (interface{}, bool) {
+	i, ok := env.fields[name]
+	if !ok || env.raw[i] == nil {
+		return nil, false
+	}
+	if env.values[i] == nil {
+		var value interface{}
+		if err := s3filter.DecodeValue(env.raw[i], &value); err != nil {
+			return nil, false
+		}
+		env.values[i] = exprValue(value)
+	}
+	return env.values[i], true
+}
+
+func (env *exprEnv) Parent() interpreter.Activation {
+	return nil
+}
+
+// Convert a decoded JSON value to the types CEL takes: integral numbers become int64 where they fit, other numbers float64
+func exprValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, item := range v {
+			v[i] = exprValue(item)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = exprValue(item)
+		}
+	}
+	return value
+}
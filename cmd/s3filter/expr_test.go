@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const exprDoc = `{"id": 150, "time": "2024-03-01T10:00:00+01:00", "words": ["error", "disk"], "ok": true,
+	"user": {"name": "svc-a", "age": 30, "tags": []}, "big": 12345678901234567890, "ratio": 2.50, "none": null}`
+
+func TestExpr(t *testing.T) {
+	record := Record{Raw: json.RawMessage(exprDoc)}
+	for _, test := range []struct {
+		expr string
+		want bool
+	}{
+		// precedence: ! binds tighter than &&, which binds tighter than ||
+		{`id == 1 || id == 150 && ok`, true},
+		{`(id == 1 || id == 150) && !ok`, false},
+		{`!ok || ok && !false`, true},
+		{`!(id == 150)`, false},
+		{`id == 1 && (ok || true)`, false},
+
+		// in: arrays, lists and map keys; substrings with contains()
+		{`"error" in words`, true},
+		{`"warn" in words`, false},
+		{`id in [1, 150]`, true},
+		{`"age" in user`, true},
+		{`"zip" in user`, false},
+		{`user.name.contains("svc")`, true},
+		{`words.exists(w, w.startsWith("dis"))`, true},
+
+		// has(), null and size()
+		{`has(user.name) && !has(user.zip)`, true},
+		{`none == null`, true},
+		{`size(words) == 2 && size(user.name) == 5 && size(user.tags) == 0 && size(user) == 3`, true},
+
+		// matches()
+		{`user.name.matches("^svc-")`, true},
+		{`matches(user.name, "^SVC")`, false},
+
+		// ints and doubles compare by value
+		{`ratio == 2.5 && ratio > 2 && ratio < 3`, true},
+		{`id == 150.0 && id > 149.5`, true},
+		{`big > 1.2e19 && big < 1.3e19`, true},
+		{`user.age >= 30 && user.age <= 30 && -1 < user.age`, true},
+
+		// strings compare lexically, times through timestamp()
+		{`timestamp(time) == timestamp("2024-03-01T09:00:00Z")`, true},
+		{`timestamp(time) < timestamp("2024-03-01T09:30:00Z")`, true},
+		{`user.name > "svc-" && user.name < "svc-b"`, true},
+	} {
+		e, err := compileExpr(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got, err := e.matches(record)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+		} else if got != test.want {
+			t.Errorf("%s = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+// Expressions that can't be evaluated on a record fail it rather than match or drop it
+func TestExprEvaluationErrors(t *testing.T) {
+	record := Record{Raw: json.RawMessage(exprDoc)}
+	for _, expr := range []string{
+		`idd == 150`,
+		`!(idd > 1)`,
+		`user.zip == "x"`,
+		`id < "x"`,
+		`!(id < "x")`,
+		`id && true`,
+		`id`,
+		`timestamp(user.name) > timestamp("2024-01-01T00:00:00Z")`,
+	} {
+		e, err := compileExpr(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got, err := e.matches(record); err == nil {
+			t.Errorf("%s = %v, want an error", expr, got)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`id >`,
+		`(id > 1`,
+		`id > 1)`,
+		`[1, 2`,
+		`id > 1 1`,
+		`id = 1`,
+		`id & ok`,
+		`"abc`,
+		`#`,
+		`in words`,
+		`&& ok`,
+	} {
+		if _, err := compileExpr(expr); err == nil {
+			t.Errorf("%q compiled", expr)
+		}
+	}
+}
+
+func TestExprMalformedRecords(t *testing.T) {
+	src := `{"id": 1, "user": "a"}` + "\n" + `{"id": 2}` + "\n" + `{"id": 3, "user": "b"}` + "\n"
+	Malformed = 0
+	out := runFilter(t, src, "-expr", `user == "b"`, "-on-malformed", "skip")
+	if !strings.Contains(out, `"id":3`) || strings.Count(out, "\n") != 1 || Malformed != 1 {
+		t.Errorf("got %q with %d malformed, want record 3 with record 2 skipped", out, Malformed)
+	}
+	for _, workers := range []string{"1", "4"} {
+		runFilter(t, "", "-expr", `user == "b"`, "-workers", workers)
+		if err := filter(strings.NewReader(src)); err == nil || !strings.Contains(err.Error(), "record 2") {
+			t.Errorf("-workers %s: got %v, want record 2 to fail", workers, err)
+		}
+	}
+}
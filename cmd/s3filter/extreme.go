@@ -0,0 +1,49 @@
+package main
+
+// Selection of a single matching record by `-first` or `-last`
+type extreme struct {
+	last   bool
+	byTime bool
+	sorted bool // the source is ordered by time
+
+	found       bool
+	record      Record
+	annotations map[string]interface{}
+}
+
+// Consider a matching record, reporting whether no later record can replace it,
+// in which case decoding stops early.
+func (e *extreme) offer(record Record, annotations map[string]interface{}) bool {
+	if !e.found {
+		e.found, e.record, e.annotations = true, record, annotations
+		return e.settled()
+	}
+
+	var better bool
+	switch {
+	case e.byTime && e.last:
+		better = record.Time.After(e.record.Time)
+	case e.byTime:
+		better = record.Time.Before(e.record.Time)
+	default:
+		better = e.last
+	}
+	if better {
+		e.record, e.annotations = record, annotations
+	}
+	return false
+}
+
+// Report whether a record was found that no later one, in this object or the next, can replace
+func (e *extreme) settled() bool {
+	return e.found && !e.last && (!e.byTime || e.sorted)
+}
+
+// Emit the selected record, if any, and start over
+func (e *extreme) flush() error {
+	if !e.found {
+		return nil
+	}
+	e.found = false
+	return emit(e.record, e.annotations)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestFirstAndLastAcrossObjects(t *testing.T) {
+	objects := []string{
+		`{"id":1,"time":"2024-01-02T00:00:00Z","words":[]}` + "\n" + `{"id":2,"time":"2024-01-01T00:00:00Z","words":[]}` + "\n",
+		`{"id":3,"time":"2024-01-03T00:00:00Z","words":[]}` + "\n" + `{"id":4,"time":"2023-12-31T00:00:00Z","words":[]}` + "\n",
+	}
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-first", "-by", "file"}, `{"id":1`},
+		{[]string{"-last", "-by", "file"}, `{"id":4`},
+		{[]string{"-first", "-by", "time"}, `{"id":4`},
+		{[]string{"-last", "-by", "time"}, `{"id":3`},
+		{[]string{"-first", "-by", "file", "-with-id", "3"}, `{"id":3`},
+	} {
+		out := runObjects(t, objects, test.args...)
+		if n := countLines(out); n != 1 || out[:len(test.want)] != test.want {
+			t.Errorf("%v: %q, want the single record %s}", test.args, out, test.want)
+		}
+	}
+
+	// -first -by=file stops at the first object that has a match
+	runObjects(t, objects, "-first", "-by", "file")
+	if Scanned != 1 {
+		t.Errorf("-first -by=file scanned %d records, want 1", Scanned)
+	}
+}
+
+func countLines(s string) int {
+	n := 0
+	for _, c := range s {
+		if c == '\n' {
+			n++
+		}
+	}
+	return n
+}
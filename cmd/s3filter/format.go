@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Output formatting from `-escape-html`, `-ascii-only` and `-line-ending`
+var (
+	EscapeHTML = true
+	ASCIIOnly  bool
+	LineEnding = "\n"
+)
+
+// Set by `-flush-size`: matches are written to Output in batches of about this many bytes
+var FlushSize = 1 << 20
+
+// Matches not yet written to Output
+var pending []byte
+
+// A JSON encoder and the buffer it writes into, reused across records
+type encoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var encoders = sync.Pool{New: func() interface{} {
+	e := &encoder{}
+	e.enc = json.NewEncoder(&e.buf)
+	return e
+}}
+
+// Parse `-line-ending`
+func parseLineEnding(value string) (string, error) {
+	switch value {
+	case "lf":
+		return "\n", nil
+	case "crlf":
+		return "\r\n", nil
+	}
+	return "", fmt.Errorf("unknown line ending %q, expected `lf` or `crlf`", value)
+}
+
+// Encode a value as one line of JSON following the escaping options, without the line ending.
+// The line is only valid until the encoder is reused.
+func (e *encoder) encode(v interface{}) ([]byte, error) {
+	e.buf.Reset()
+	e.enc.SetEscapeHTML(EscapeHTML)
+	if err := e.enc.Encode(v); err != nil {
+		return nil, err
+	}
+	s := bytes.TrimSuffix(e.buf.Bytes(), []byte{'\n'})
+	if ASCIIOnly {
+		s = escapeNonASCII(s)
+	}
+	return s, nil
+}
+
+// Compact a raw document onto one line following the escaping options, keeping its keys, their order and values as read.
+// The line is only valid until the encoder is reused.
+func (e *encoder) compact(raw json.RawMessage) ([]byte, error) {
+	e.buf.Reset()
+	if err := json.Compact(&e.buf, raw); err != nil {
+		return nil, err
+	}
+	return escape(e.buf.Bytes()), nil
+}
+
+// Report whether `-escape-html` or `-ascii-only` rewrite a compacted document
+func escapes(s []byte) bool {
+	return ASCIIOnly || EscapeHTML && bytes.ContainsAny(s, htmlSpecials)
+}
+
+// Characters json.HTMLEscape rewrites
+const htmlSpecials = "<>&\u2028\u2029"
+
+// Apply `-escape-html` and `-ascii-only` to a compacted document
+func escape(s []byte) []byte {
+	if EscapeHTML && bytes.ContainsAny(s, htmlSpecials) {
+		var escaped bytes.Buffer
+		json.HTMLEscape(&escaped, s)
+		s = escaped.Bytes()
+	}
+	if ASCIIOnly {
+		s = escapeNonASCII(s)
+	}
+	return s
+}
+
+// Add a raw document to the pending output, compacted straight into it, writing it out once FlushSize is reached
+func writeRaw(raw json.RawMessage) error {
+	start := len(pending)
+	buf := bytes.NewBuffer(pending)
+	if err := json.Compact(buf, raw); err != nil {
+		return err
+	}
+	pending = buf.Bytes()
+	if line := pending[start:]; escapes(line) {
+		pending = append(pending[:start], escape(line)...)
+	}
+	return endLine()
+}
+
+// Add a line to the pending output, writing it out once FlushSize is reached
+func writeLine(line []byte) error {
+	pending = append(pending, line...)
+	return endLine()
+}
+
+// End the pending line, writing the output out once FlushSize is reached
+func endLine() error {
+	pending = append(pending, LineEnding...)
+	if len(pending) < FlushSize {
+		return nil
+	}
+	return flushOutput()
+}
+
+// Write the pending output in a single Write, so that a batch never ends inside a record
+func flushOutput() error {
+	if len(pending) == 0 {
+		return nil
+	}
+	_, err := Output.Write(pending)
+	pending = pending[:0]
+	return err
+}
+
+// Replace non-ASCII characters with `\uXXXX` escapes (surrogate pairs above U+FFFF).
+// Encoded JSON only contains them inside strings, where the escapes are equivalent.
+func escapeNonASCII(s []byte) []byte {
+	var out bytes.Buffer
+	for len(s) > 0 {
+		r, size := utf8.DecodeRune(s)
+		s = s[size:]
+		switch {
+		case r < utf8.RuneSelf:
+			out.WriteByte(byte(r))
+		case r > 0xFFFF:
+			high, low := utf16.EncodeRune(r)
+			fmt.Fprintf(&out, `\u%04x\u%04x`, high, low)
+		default:
+			fmt.Fprintf(&out, `\u%04x`, r)
+		}
+	}
+	return out.Bytes()
+}
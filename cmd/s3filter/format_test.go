@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestEmitAsRead(t *testing.T) {
+	src := `{ "words": ["x"], "time": "2024-03-01T10:00:00.000+01:00", "id": 7, "note": "a<b é" }` + "\n"
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{nil, `{"words":["x"],"time":"2024-03-01T10:00:00.000+01:00","id":7,"note":"a\u003cb é"}` + "\n"},
+		{[]string{"-escape-html=false", "-ascii-only"}, `{"words":["x"],"time":"2024-03-01T10:00:00.000+01:00","id":7,"note":"a<b \u00e9"}` + "\n"},
+	} {
+		if got := runFilter(t, src, append([]string{"-with-word", "x"}, test.args...)...); got != test.want {
+			t.Errorf("%v: emitted %s, want %s", test.args, got, test.want)
+		}
+	}
+}
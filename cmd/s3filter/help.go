@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A subcommand, dispatched by name and listed in the help
+type subcommand struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string)
+}
+
+var subcommands []subcommand
+
+// Filled in by init, as the subcommands themselves print the help
+func init() {
+	subcommands = []subcommand{
+		{"get", "get s3://{bucket}/{key} [path]", "Download an object to a local path or stdout.", runGet},
+		{"decompress", "decompress {s3://{bucket}/{key}|path|-} [path]", "Decompress a gzip, zstd or bzip2 S3 object, local file or stdin (detected by its magic bytes) to a local path or stdout.", runDecompress},
+		{"put", "put [flags] {path|-} s3://{bucket}/{key}", "Filter and validate a local file or stdin, then upload it (gzip compressed for `.gz` keys).", runPut},
+		{"copy", "copy [flags] -src s3://{bucket}/{key} -dst s3://{bucket}/{key}", "Filter an object into another bucket or key, preserving its metadata and tags.", runCopy},
+		{"sync", "sync [flags] -src s3://{bucket}/{prefix} -dst s3://{bucket}/{prefix} [-delete] [-manifest redshift|snowflake]", "Maintain a filtered mirror of a prefix, processing only new or changed objects.", runSync},
+		{"athena", "athena -location s3://{bucket}/{prefix} -query {sql} -output-location s3://{bucket}/{prefix}", "Run an Athena query against filtered output, referred to as `records`, and print the results.", runAthena},
+		{"digest", "digest {s3://{bucket}/{key}|path|-}", "Print the hash chain digest of an extract, to compare with the one reported by `-hash-chain`.", runDigest},
+		{"history", "history [-history {path|s3://{bucket}/{prefix}/}] [show {id}]", "List past runs with their criteria and results, or show one in full.", runHistory},
+	}
+}
+
+// Flags the filter command cannot run without
+var requiredFlags = map[string]bool{"input": true}
+
+const dockerExample = "docker run --rm -e AWS_REGION -e AWS_ACCESS_KEY_ID -e AWS_SECRET_ACCESS_KEY s3filter -input s3://maf-sample-data/1k.ndjson.gz -from-time=2000-01-01T00:00:00Z -to-time=2001-01-01T00:00:00Z"
+
+// A flag as listed in the help
+type flagHelp struct {
+	Name        string `json:"name"`
+	Required    bool   `json:"required"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description"`
+}
+
+// A subcommand as listed in the help
+type commandHelp struct {
+	Usage       string `json:"usage"`
+	Description string `json:"description"`
+}
+
+// Print the help generated from the flags defined on flags and the subcommands, as `md` tables, `text` or `json`
+func printHelp(w io.Writer, flags *flag.FlagSet, format string) error {
+	var flagList []flagHelp
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "help-format" {
+			return
+		}
+		flagList = append(flagList, flagHelp{Name: f.Name, Required: requiredFlags[f.Name], Default: f.DefValue, Description: f.Usage})
+	})
+	var commands []commandHelp
+	for _, command := range subcommands {
+		commands = append(commands, commandHelp{Usage: command.usage, Description: command.description})
+	}
+
+	switch format {
+	case "md":
+		fmt.Fprintln(w, "| Name | Required | Description |")
+		fmt.Fprintln(w, "| ---- | -------- | ----------- |")
+		for _, f := range flagList {
+			required := "No"
+			if f.Required {
+				required = "Yes"
+			}
+			fmt.Fprintf(w, "| `-%s` | %s | %s |\n", f.Name, required, escapeCell(f.Description))
+		}
+		fmt.Fprintln(w, "Subcommands:")
+		fmt.Fprintln(w, "| Command | Description |")
+		fmt.Fprintln(w, "| ------- | ----------- |")
+		for _, command := range commands {
+			fmt.Fprintf(w, "| `%s` | %s |\n", escapeCell(command.Usage), escapeCell(command.Description))
+		}
+		fmt.Fprintln(w, "Docker Command:")
+		fmt.Fprintln(w, dockerExample)
+	case "text":
+		fmt.Fprintln(w, "Usage: s3filter -input s3://{bucket}/{key} [flags]")
+		fmt.Fprintln(w, "       s3filter {subcommand} [args]")
+		fmt.Fprintln(w, "\nFlags:")
+		for _, f := range flagList {
+			name := "-" + f.Name
+			switch {
+			case f.Required:
+				name += " (required)"
+			case f.Default != "" && f.Default != "false" && f.Default != "0":
+				name += fmt.Sprintf(" (default %s)", f.Default)
+			}
+			fmt.Fprintf(w, "  %s\n    \t%s\n", name, f.Description)
+		}
+		fmt.Fprintln(w, "\nSubcommands:")
+		for _, command := range commands {
+			fmt.Fprintf(w, "  s3filter %s\n    \t%s\n", command.Usage, command.Description)
+		}
+		fmt.Fprintln(w, "\nDocker:")
+		fmt.Fprintf(w, "  %s\n", dockerExample)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]interface{}{"flags": flagList, "subcommands": commands})
+	default:
+		return fmt.Errorf("unknown help format %q, expected `md`, `text` or `json`", format)
+	}
+	return nil
+}
+
+// Escape the pipes of a Markdown table cell
+func escapeCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
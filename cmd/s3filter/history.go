@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"s3filter"
+)
+
+// Set by `-history` (or `S3FILTER_HISTORY`): where run summaries are kept.
+// Empty means the default local file, `off` disables it; otherwise a local file or an `s3://{bucket}/{prefix}/`.
+var History string
+
+// Summary of one run, kept in the history
+type RunRecord struct {
+	ID       string                 `json:"id"`
+	Command  string                 `json:"command"`
+	Args     []string               `json:"args"`
+	Flags    map[string]interface{} `json:"flags"`
+	Started  time.Time              `json:"started"`
+	Duration float64                `json:"duration_seconds"`
+	Status   string                 `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Scanned  int64                  `json:"scanned"`
+	Matched  int64                  `json:"matched"`
+	Failures []string               `json:"failures,omitempty"`
+	Digest   string                 `json:"digest,omitempty"`
+	Cost     float64                `json:"estimated_cost_usd,omitempty"`
+}
+
+// The run being recorded, set once its flags are parsed
+var (
+	runFlagSet *flag.FlagSet
+	runStarted time.Time
+)
+
+// Start recording a run of the command whose flags are flags
+func beginRun(flags *flag.FlagSet) {
+	runFlagSet = flags
+	runStarted = time.Now()
+}
+
+// Add the outcome of the current run to the history; failures to do so are only warned about
+func recordRun(status string, runErr string) {
+	if runFlagSet == nil || History == "off" {
+		return
+	}
+	flags := runFlagSet
+	runFlagSet = nil
+
+	command := flags.Name()
+	if flags == flag.CommandLine {
+		command = "filter"
+	}
+	set := map[string]interface{}{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = flagValue(f)
+	})
+	run := RunRecord{
+		ID:       runID(runStarted),
+		Command:  command,
+		Args:     os.Args[1:],
+		Flags:    set,
+		Started:  runStarted.UTC(),
+		Duration: time.Since(runStarted).Seconds(),
+		Status:   status,
+		Error:    runErr,
+		Scanned:  Scanned,
+		Matched:  Matched,
+		Failures: Failures,
+	}
+	if Chain != nil {
+		run.Digest = Chain.digest()
+	}
+	if Usage != nil {
+		run.Cost = Usage.cost(CostTable)
+	}
+
+	if err := saveRun(run); err != nil && History != "" {
+		fmt.Fprintf(os.Stderr, "Unable to record the run in %s %v\n", History, err)
+	}
+}
+
+// A sortable, unique run id, e.g. `20230118T093000Z-1a2b3c`
+func runID(started time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return started.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// The default history file, in the user's configuration directory
+func defaultHistory() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "s3filter", "history.jsonl"), nil
+}
+
+// Append a run to the local history file, or store it as `{prefix}{id}.json` under the S3 history prefix
+func saveRun(run RunRecord) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(History, "s3://") {
+		bucket, prefix, err := s3filter.ParsePrefix(History)
+		if err != nil {
+			return err
+		}
+		sess, err := newSession()
+		if err != nil {
+			return err
+		}
+		_, err = s3.New(sess).PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(prefix + run.ID + ".json"),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		})
+		return err
+	}
+
+	path := History
+	if path == "" {
+		if path, err = defaultHistory(); err != nil {
+			return err
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read every run of the history, oldest first
+func loadRuns() ([]RunRecord, error) {
+	var runs []RunRecord
+	if strings.HasPrefix(History, "s3://") {
+		bucket, prefix, err := s3filter.ParsePrefix(History)
+		if err != nil {
+			return nil, err
+		}
+		sess, err := newSession()
+		if err != nil {
+			return nil, err
+		}
+		objects, err := s3filter.ListObjects(s3.New(sess), bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			data, err := download(sess, bucket, aws.StringValue(object.Key))
+			if err != nil {
+				return nil, err
+			}
+			var run RunRecord
+			if err = json.Unmarshal(data, &run); err != nil {
+				return nil, fmt.Errorf("%s: %v", aws.StringValue(object.Key), err)
+			}
+			runs = append(runs, run)
+		}
+	} else {
+		path := History
+		if path == "" {
+			var err error
+			if path, err = defaultHistory(); err != nil {
+				return nil, err
+			}
+		}
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			var run RunRecord
+			if err = json.Unmarshal(scanner.Bytes(), &run); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			runs = append(runs, run)
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Started.Before(runs[j].Started) })
+	return runs, nil
+}
+
+// `s3filter history [-history {path|s3://{bucket}/{prefix}/}] [show {id}]`
+// List past runs, or show one in full.
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flags.StringVar(&History, "history", os.Getenv("S3FILTER_HISTORY"), "Where run summaries are kept: a local file or `s3://{bucket}/{prefix}/`; the user configuration directory by default.")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter history [-history {path|s3://{bucket}/{prefix}/}] [show {id}]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	show := flags.NArg() == 2 && flags.Arg(0) == "show"
+	if flags.NArg() != 0 && !show {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	runs, err := loadRuns()
+	if err != nil {
+		exitErrorf("Unable to read the run history %v", err)
+	}
+
+	if show {
+		for _, run := range runs {
+			if run.ID == flags.Arg(1) {
+				data, err := json.MarshalIndent(run, "", "  ")
+				if err != nil {
+					exitErrorf("%v", err)
+				}
+				fmt.Println(string(data))
+				return
+			}
+		}
+		exitErrorf("No run %s in the history", flags.Arg(1))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tSTATUS\tMATCHED\tSCANNED\tCOMMAND")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", run.ID, run.Started.Local().Format(time.RFC3339), run.Status, run.Matched, run.Scanned, strings.Join(append([]string{"s3filter"}, run.Args...), " "))
+	}
+	w.Flush()
+}
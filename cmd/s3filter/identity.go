@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Set by `-print-identity`
+var PrintIdentity bool
+
+// Print which credential provider was used and the identity it resolved to.
+// The default chain covers environment variables, shared profiles, web identity tokens (EKS IRSA), ECS task roles and EC2 instance roles over IMDSv2.
+func printIdentity(sess *session.Session) error {
+	creds, err := sess.Config.Credentials.Get()
+	if err != nil {
+		return err
+	}
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Identity: %s (account %s, provider %s)\n",
+		aws.StringValue(identity.Arn), aws.StringValue(identity.Account), creds.ProviderName)
+	return nil
+}
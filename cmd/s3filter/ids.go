@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Collect the ids of `-with-id` (repeated or comma-separated) and of the `-with-id-file`, one per line.
+// Blank lines and lines starting with `#` in the file are skipped.
+func parseIDs(values []string, path string) ([]int64, error) {
+	var ids []int64
+	add := func(text string) error {
+		id, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	}
+
+	for _, value := range values {
+		for _, text := range strings.Split(value, ",") {
+			if err := add(text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if path == "" {
+		return ids, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err = add(text); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	return ids, scanner.Err()
+}
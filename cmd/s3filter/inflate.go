@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"s3filter"
+)
+
+// Decompression limits from `-max-decompressed-bytes` and `-max-expansion-ratio`, zero meaning unlimited
+var (
+	MaxDecompressed int64
+	MaxExpansion    float64
+)
+
+// Set by `-no-decompress`: read every object as plain NDJSON whatever its name or first bytes
+var NoDecompress bool
+
+func limits() s3filter.Limits {
+	return s3filter.Limits{MaxBytes: MaxDecompressed, MaxRatio: MaxExpansion}
+}
+
+// Report whether a key or file name denotes a compressed object (`.gz`, `.zst` or `.bz2`)
+func compressed(name string) bool {
+	return !NoDecompress && (strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".zst") || strings.HasSuffix(name, ".bz2"))
+}
+
+// Open a decompressing stream for the named object, detecting its format from its first bytes, checked against the decompression limits as it is read
+func decompress(src io.Reader, name string) (io.Reader, error) {
+	if NoDecompress {
+		return src, nil
+	}
+	return s3filter.Decompress(src, name, limits())
+}
+
+// Decompress a whole object, detecting gzip, zstd, bzip2 or plain text from its first bytes or else its name
+func inflate(data []byte, name string) ([]byte, error) {
+	if NoDecompress {
+		return data, nil
+	}
+	return s3filter.Inflate(data, name, limits())
+}
+
+// Compressed bytes each `-workers` worker may look ahead when splitting gzip members out of a stream
+const memberWindow = 4 << 20
+
+// Decompress a stream as it arrives. With `-workers`, the members of a multi-member gzip object are
+// inflated concurrently from a bounded look-ahead window until the reader is closed.
+func decompressStream(src io.Reader, name string) (io.ReadCloser, error) {
+	if NoDecompress || *Workers <= 1 {
+		reader, err := decompress(src, name)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	}
+	buffered := bufio.NewReader(src)
+	head, _ := buffered.Peek(4)
+	if s3filter.Detect(head, name) != s3filter.Gzip {
+		reader, err := decompress(buffered, name)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	}
+	return s3filter.GunzipStream(buffered, *Workers, *Workers*memberWindow, limits()), nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestCompressed(t *testing.T) {
+	defer func() { NoDecompress = false }()
+	for _, test := range []struct {
+		name         string
+		noDecompress bool
+		want         bool
+	}{
+		{"a.json.gz", false, true},
+		{"a.json.zst", false, true},
+		{"a.json.bz2", false, true},
+		{"a.json", false, false},
+		{"a.json.gz", true, false},
+		{"a.json.zst", true, false},
+		{"a.json.bz2", true, false},
+	} {
+		NoDecompress = test.noDecompress
+		if got := compressed(test.name); got != test.want {
+			t.Errorf("compressed(%q) with NoDecompress %v = %v, want %v", test.name, test.noDecompress, got, test.want)
+		}
+	}
+}
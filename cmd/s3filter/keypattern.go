@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// Key naming convention from `-key-pattern`, e.g. `events_{shard}_{yyyyMMdd}.ndjson.gz`.
+// Time and shard placeholders embedded in keys prune candidate objects before they are inspected or downloaded.
+type KeyPattern struct {
+	re     *regexp.Regexp
+	unit   string
+	shards []string
+	parts  []keyPart
+}
+
+// A literal run of a key pattern, or one of its placeholders
+type keyPart struct {
+	literal     string
+	placeholder string
+}
+
+// Placeholders and the regular expressions matching them
+var keyPlaceholders = map[string]string{
+	"shard":      `(?P<shard>[^/]+?)`,
+	"yyyy":       `(?P<yyyy>\d{4})`,
+	"MM":         `(?P<MM>\d{2})`,
+	"dd":         `(?P<dd>\d{2})`,
+	"HH":         `(?P<HH>\d{2})`,
+	"yyyyMMdd":   `(?P<yyyy>\d{4})(?P<MM>\d{2})(?P<dd>\d{2})`,
+	"yyyyMMddHH": `(?P<yyyy>\d{4})(?P<MM>\d{2})(?P<dd>\d{2})(?P<HH>\d{2})`,
+}
+
+// The time layout of each time placeholder, and that of the period every key with one value of it shares
+var keyLayouts = map[string]struct{ value, period string }{
+	"yyyy":       {"2006", "2006"},
+	"MM":         {"01", "200601"},
+	"dd":         {"02", "20060102"},
+	"HH":         {"15", "2006010215"},
+	"yyyyMMdd":   {"20060102", "20060102"},
+	"yyyyMMddHH": {"2006010215", "2006010215"},
+}
+
+// Compile a key pattern; shards, when given, restrict the admitted `{shard}` values
+func parseKeyPattern(pattern string, shards []string) (*KeyPattern, error) {
+	var expr strings.Builder
+	var parts []keyPart
+	expr.WriteString(`(^|/)`)
+	for rest := pattern; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			parts = append(parts, keyPart{literal: rest})
+			break
+		}
+		close := strings.IndexByte(rest[open:], '}')
+		if close < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in key pattern %q", pattern)
+		}
+		name := rest[open+1 : open+close]
+		placeholder, ok := keyPlaceholders[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown placeholder {%s} in key pattern %q", name, pattern)
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:open]))
+		expr.WriteString(placeholder)
+		parts = append(parts, keyPart{literal: rest[:open]}, keyPart{placeholder: name})
+		rest = rest[open+close+1:]
+	}
+	expr.WriteString(`$`)
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid key pattern %q: %v", pattern, err)
+	}
+
+	k := &KeyPattern{re: re, shards: shards, parts: parts}
+	for _, unit := range []string{"HH", "dd", "MM", "yyyy"} {
+		if slices.Contains(re.SubexpNames(), unit) {
+			k.unit = unit
+			break
+		}
+	}
+	return k, nil
+}
+
+// Report whether an object key may hold records of interest:
+// keys that don't follow the pattern are kept, keys whose period lies outside
+// `-from-time`/`-to-time` or whose shard isn't selected are pruned.
+func (k *KeyPattern) admits(key string) bool {
+	match := k.re.FindStringSubmatch(key)
+	if match == nil {
+		return true
+	}
+
+	fields := make(map[string]string)
+	for i, name := range k.re.SubexpNames() {
+		if name != "" && match[i] != "" {
+			fields[name] = match[i]
+		}
+	}
+
+	if shard, ok := fields["shard"]; ok && len(k.shards) > 0 && !slices.Contains(k.shards, shard) {
+		return false
+	}
+
+	if k.unit == "" {
+		return true
+	}
+	number := func(name string, fallback int) int {
+		if n, err := strconv.Atoi(fields[name]); err == nil {
+			return n
+		}
+		return fallback
+	}
+	start := time.Date(number("yyyy", 1), time.Month(number("MM", 1)), number("dd", 1), number("HH", 0), 0, 0, 0, time.UTC)
+	var end time.Time
+	switch k.unit {
+	case "HH":
+		end = start.Add(time.Hour)
+	case "dd":
+		end = start.AddDate(0, 0, 1)
+	case "MM":
+		end = start.AddDate(0, 1, 0)
+	case "yyyy":
+		end = start.AddDate(1, 0, 0)
+	}
+
+	if !FromTime.IsZero() && !end.After(FromTime) {
+		return false
+	}
+	if !ToTime.IsZero() && start.After(ToTime) {
+		return false
+	}
+	return true
+}
+
+// The longest beginning shared by every key that follows the pattern and may be admitted:
+// its literal text up to the first placeholder that can take more than one value, with the placeholders before it
+// filled in, where `-from-time` and `-to-time` fall within one period of a time placeholder and one `-shard` is selected.
+// Prefixes are listed from there, so keys that don't follow the pattern from the listed prefix on aren't listed.
+func (k *KeyPattern) prefix() string {
+	var prefix strings.Builder
+	for _, part := range k.parts {
+		value, fixed := part.literal, true
+		switch layout, isTime := keyLayouts[part.placeholder]; {
+		case part.placeholder == "shard":
+			fixed = len(k.shards) == 1
+			if fixed {
+				value = k.shards[0]
+			}
+		case isTime:
+			from, to := FromTime.UTC(), ToTime.UTC()
+			fixed = !FromTime.IsZero() && !ToTime.IsZero() && from.Format(layout.period) == to.Format(layout.period)
+			value = from.Format(layout.value)
+		}
+		if !fixed {
+			break
+		}
+		prefix.WriteString(value)
+	}
+	return prefix.String()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Set the time window of a test, restoring the previous one after it
+func window(t *testing.T, from, to string) {
+	t.Helper()
+	saved, savedTo := FromTime, ToTime
+	t.Cleanup(func() { FromTime, ToTime = saved, savedTo })
+	FromTime, ToTime = time.Time{}, time.Time{}
+	var err error
+	if from != "" {
+		if FromTime, err = parseTimeExpr(from, time.Now(), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if to != "" {
+		if ToTime, err = parseTimeExpr(to, time.Now(), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKeyPatternAdmits(t *testing.T) {
+	pattern, err := parseKeyPattern("events_{shard}_{yyyyMMdd}.ndjson.gz", []string{"eu", "us"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	window(t, "2024-06-02", "2024-06-03")
+	for key, want := range map[string]bool{
+		"events_eu_20240602.ndjson.gz":         true,
+		"logs/events_us_20240603.ndjson.gz":    true,
+		"events_eu_20240601.ndjson.gz":         false,
+		"events_eu_20240604.ndjson.gz":         false,
+		"events_ap_20240602.ndjson.gz":         false,
+		"other.ndjson.gz":                      true,
+		"xevents_ap_20240601.ndjson.gz":        true,
+		"events_eu_20240602.ndjson.gz.partial": true,
+	} {
+		if got := pattern.admits(key); got != want {
+			t.Errorf("%s admitted %v, want %v", key, got, want)
+		}
+	}
+
+	hourly, err := parseKeyPattern("{yyyy}/{MM}/{dd}/{HH}/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	window(t, "2024-06-02T10:30:00Z", "2024-06-02T11:00:00Z")
+	for key, want := range map[string]bool{
+		"2024/06/02/09/": false,
+		"2024/06/02/10/": true,
+		"2024/06/02/11/": true,
+		"2024/06/02/12/": false,
+	} {
+		if got := hourly.admits(key); got != want {
+			t.Errorf("%s admitted %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestKeyPatternErrors(t *testing.T) {
+	for _, pattern := range []string{"events_{yyyyMMdd", "events_{week}.gz", "{"} {
+		if _, err := parseKeyPattern(pattern, nil); err == nil {
+			t.Errorf("%q parsed", pattern)
+		}
+	}
+}
+
+func TestKeyPatternPrefix(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		shards   []string
+		from, to string
+		want     string
+	}{
+		{"events_{shard}_{yyyyMMdd}.gz", nil, "", "", "events_"},
+		{"events_{shard}_{yyyyMMdd}.gz", []string{"eu"}, "", "", "events_eu_"},
+		{"events_{shard}_{yyyyMMdd}.gz", []string{"eu"}, "2024-06-02", "2024-06-02", "events_eu_20240602.gz"},
+		{"events_{shard}_{yyyyMMdd}.gz", []string{"eu"}, "2024-06-02", "2024-06-03", "events_eu_"},
+		{"events_{shard}_{yyyyMMdd}.gz", []string{"eu", "us"}, "2024-06-02", "2024-06-02", "events_"},
+		{"{yyyy}/{MM}/{dd}/part-{shard}.gz", nil, "2024-06-02", "2024-06-30", "2024/06/"},
+		{"{yyyy}/{MM}/{dd}/part-{shard}.gz", nil, "2024-06-02", "", ""},
+		{"{yyyy}/{MM}/{dd}/part-{shard}.gz", nil, "2023-06-02", "2024-06-03", ""},
+		// June of another year lies between
+		{"{MM}/{yyyy}/part.gz", nil, "2023-06-02", "2024-06-03", ""},
+		{"{yyyyMMddHH}.gz", nil, "2024-06-02T10:05:00Z", "2024-06-02T10:55:00Z", "2024060210.gz"},
+		// key times are UTC
+		{"{yyyy}/{MM}/{dd}/", nil, "2024-06-02T23:30:00-02:00", "2024-06-03T01:00:00Z", "2024/06/03/"},
+	} {
+		pattern, err := parseKeyPattern(test.pattern, test.shards)
+		if err != nil {
+			t.Fatal(err)
+		}
+		window(t, test.from, test.to)
+		if got := pattern.prefix(); got != test.want {
+			t.Errorf("%s %v %s..%s: got prefix %q, want %q", test.pattern, test.shards, test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestExpandInputsPrunes(t *testing.T) {
+	var prefixes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Query().Get("prefix")
+		prefixes = append(prefixes, prefix)
+		fmt.Fprint(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`)
+		for _, key := range []string{"logs/events_eu_20240602.gz", "logs/events_eu_20240603.gz"} {
+			if strings.HasPrefix(key, prefix) {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>1</Size></Contents>`, key)
+			}
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	}))
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runFilter(t, "", "-key-pattern", "events_{shard}_{yyyyMMdd}.gz", "-shard", "eu", "-from-time", "2024-06-02", "-to-time", "2024-06-02")
+	uris, err := expandInputs(s3.New(sess), []string{"s3://b/logs/", "s3://b/other/events_eu_20240601.gz", "s3://b/other/events_eu_20240602.gz", "https://example.com/x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"s3://b/logs/events_eu_20240602.gz", "s3://b/other/events_eu_20240602.gz", "https://example.com/x"}
+	if fmt.Sprint(uris) != fmt.Sprint(want) {
+		t.Errorf("expanded to %q, want %q", uris, want)
+	}
+	if fmt.Sprint(prefixes) != "[logs/events_eu_20240602.gz]" {
+		t.Errorf("listed %q, want the prefix the pattern fixes", prefixes)
+	}
+}
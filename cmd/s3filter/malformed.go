@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Set by `-on-malformed`: what to do with lines that are valid JSON but not a usable record
+var OnMalformed *string
+
+// Lines skipped or dead-lettered by `-on-malformed`
+var Malformed int64
+
+// Handle a line that is valid JSON but not a usable record according to `-on-malformed`
+func malformed(index int64, offset int64, raw json.RawMessage, err error) error {
+	err = fmt.Errorf("%s at offset %d: %v", recordName(index), offset, err)
+	switch *OnMalformed {
+	case "skip":
+	case "dead-letter":
+		if deadErr := deadLetter(append(raw, '\n')); deadErr != nil {
+			return deadErr
+		}
+	default:
+		return err
+	}
+	Malformed++
+	fmt.Fprintln(os.Stderr, "Skipped", err)
+	return nil
+}
+
+// Name the record at the 1-based index of the object being filtered
+func recordName(index int64) string {
+	if Object == "" {
+		return fmt.Sprintf("record %d", index)
+	}
+	return fmt.Sprintf("record %d of %s", index, Object)
+}
+
+// Write to the `-dead-letter` file; a record that can't be set aside fails the run rather than being lost
+func deadLetter(p []byte) error {
+	if _, err := DeadLetter.Write(p); err != nil {
+		return fmt.Errorf("unable to write to -dead-letter file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMalformedNumberedWithinObject(t *testing.T) {
+	for _, workers := range []string{"1", "4"} {
+		runFilter(t, "", "-on-malformed", "fail", "-workers", workers)
+		if err := filter(strings.NewReader(numbered(5))); err != nil {
+			t.Fatal(err)
+		}
+		Object = "s3://bucket/b.json"
+		err := filter(strings.NewReader("{\"id\":1}\n[1]\n"))
+		Object = ""
+		if want := "record 2 of s3://bucket/b.json at offset"; err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("-workers %s: %v, want %q", workers, err, want)
+		}
+	}
+}
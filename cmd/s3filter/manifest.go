@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"s3filter"
+)
+
+// Redshift Spectrum manifest (https://docs.aws.amazon.com/redshift/latest/dg/loading-data-files-using-manifest.html)
+type spectrumManifest struct {
+	Entries []spectrumEntry `json:"entries"`
+}
+
+type spectrumEntry struct {
+	URL       string `json:"url"`
+	Mandatory bool   `json:"mandatory"`
+	Meta      struct {
+		ContentLength int64 `json:"content_length"`
+	} `json:"meta"`
+}
+
+// Expose a filtered prefix as an external table in the `warehouse` (`redshift` or `snowflake`).
+// For Redshift Spectrum a manifest listing the prefix's objects is uploaded next to it, as `{prefix}.manifest.json`.
+// The DDL to create the table is printed to stdout.
+func emitManifest(sess *session.Session, warehouse string, bucket string, prefix string) error {
+	name := strings.TrimSuffix(prefix, "/")
+	location := fmt.Sprintf("s3://%s/%s", bucket, prefix)
+
+	switch warehouse {
+	case "snowflake":
+		fmt.Fprintf(os.Stdout, "CREATE STAGE s3filter_records URL = '%s' FILE_FORMAT = (TYPE = JSON);\n", location)
+		fmt.Fprintln(os.Stdout, "-- add the STORAGE_INTEGRATION or CREDENTIALS used by the account to the stage")
+		fmt.Fprintln(os.Stdout, "CREATE EXTERNAL TABLE records (id NUMBER AS (value:id::NUMBER), time TIMESTAMP_TZ AS (value:time::TIMESTAMP_TZ), words ARRAY AS (value:words::ARRAY)) "+
+			"LOCATION = @s3filter_records AUTO_REFRESH = FALSE FILE_FORMAT = (TYPE = JSON);")
+		return nil
+
+	case "redshift":
+		// the manifest sits beside the prefix, so it must not match it
+		if name == "" || !strings.HasSuffix(prefix, "/") {
+			return fmt.Errorf("a manifest needs a destination prefix ending in `/`, got %q", prefix)
+		}
+		objects, err := s3filter.ListObjects(s3.New(sess), bucket, prefix)
+		if err != nil {
+			return err
+		}
+		var manifest spectrumManifest
+		for _, object := range objects {
+			entry := spectrumEntry{URL: fmt.Sprintf("s3://%s/%s", bucket, aws.StringValue(object.Key)), Mandatory: true}
+			entry.Meta.ContentLength = aws.Int64Value(object.Size)
+			manifest.Entries = append(manifest.Entries, entry)
+		}
+		body, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		key := name + ".manifest.json"
+		_, err = s3manager.NewUploader(sess).Upload(&s3manager.UploadInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, "CREATE EXTERNAL TABLE spectrum.records (id bigint, \"time\" varchar(64), words array<varchar(256)>) "+
+			"ROW FORMAT SERDE 'org.openx.data.jsonserde.JsonSerDe' "+
+			fmt.Sprintf("LOCATION 's3://%s/%s';", bucket, key))
+		return nil
+	}
+	return fmt.Errorf("unknown warehouse %q, expected `redshift` or `snowflake`", warehouse)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Output and transfer settings tuned together by `-mode`
+type preset struct {
+	flushSize         int  // bytes of matches buffered before they are written
+	stream            bool // read objects as a single stream rather than downloading them whole first
+	concurrencyPerCPU int  // ranged GETs of a download per usable CPU
+	maxConcurrency    int  // ranged GETs of a download at most
+}
+
+// `-mode` presets: `interactive` shows matches as soon as they are read,
+// `batch` maximizes total throughput at the cost of latency and memory
+var presets = map[string]preset{
+	"interactive": {flushSize: 0, stream: true, concurrencyPerCPU: 2, maxConcurrency: 6},
+	"batch":       {flushSize: 8 << 20, concurrencyPerCPU: 4, maxConcurrency: 16},
+}
+
+// Set by `-mode`; the settings in use when it is not given
+var (
+	Mode   string
+	Preset = preset{flushSize: 1 << 20, concurrencyPerCPU: 2, maxConcurrency: 6}
+)
+
+// Select the preset of `-mode`; explicit is the set of flags given on the command line, which the preset doesn't override
+func applyMode(explicit map[string]bool) error {
+	switch {
+	case Mode != "":
+		p, ok := presets[Mode]
+		if !ok {
+			return fmt.Errorf("unknown mode %q, expected `interactive` or `batch`", Mode)
+		}
+		Preset = p
+	case isTerminal(os.Stdout):
+		// show matches as they are found on a terminal
+		Preset.flushSize = 0
+	}
+	if !explicit["flush-size"] {
+		FlushSize = Preset.flushSize
+	}
+	return nil
+}
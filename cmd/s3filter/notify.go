@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Post text to the `-notify` webhook, if one is configured.
+// `slack://` and `teams://` URIs are sent over HTTPS as incoming webhook messages,
+// both of which accept a plain `{"text": ...}` payload.
+func notify(text string) {
+	if Notify == nil || *Notify == "" {
+		return
+	}
+
+	endpoint, err := webhookURL(*Notify)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to send notification:", err)
+		return
+	}
+
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to send notification:", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to send notification:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		fmt.Fprintln(os.Stderr, "Unable to send notification: webhook returned", resp.Status)
+	}
+}
+
+// Translate a `slack://` or `teams://` URI to the HTTPS webhook URL
+func webhookURL(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "slack", "teams":
+		u.Scheme = "https"
+	case "https":
+	default:
+		return "", fmt.Errorf("unsupported notification scheme %q", u.Scheme)
+	}
+
+	return u.String(), nil
+}
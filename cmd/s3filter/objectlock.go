@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Object Lock settings for written objects from `-object-lock-mode`, `-object-lock-retain-until` and `-legal-hold`
+var (
+	LockMode    string
+	RetainUntil time.Time
+	LegalHold   bool
+)
+
+// Buckets already confirmed to have Object Lock enabled
+var lockEnabled = map[string]bool{}
+
+// Parse `-object-lock-retain-until`: an RFC3339 timestamp, or a retention period from now such as `2160h`
+func parseRetainUntil(value string) (time.Time, error) {
+	if period, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(period), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Apply the Object Lock settings to an upload, after checking the bucket has Object Lock enabled.
+// The Content-MD5 that Object Lock puts require is added by the SDK to every part.
+func lockUpload(client *s3.S3, input *s3manager.UploadInput) error {
+	if LockMode == "" && !LegalHold {
+		return nil
+	}
+
+	bucket := aws.StringValue(input.Bucket)
+	if !lockEnabled[bucket] {
+		config, err := client.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{Bucket: input.Bucket})
+		if err != nil && !isErrCode(err, "ObjectLockConfigurationNotFoundError") {
+			return err
+		}
+		if config == nil || config.ObjectLockConfiguration == nil ||
+			aws.StringValue(config.ObjectLockConfiguration.ObjectLockEnabled) != s3.ObjectLockEnabledEnabled {
+			return fmt.Errorf("bucket %s does not have Object Lock enabled, so retention and legal holds cannot be set", bucket)
+		}
+		lockEnabled[bucket] = true
+	}
+
+	if LockMode != "" {
+		input.ObjectLockMode = aws.String(LockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(RetainUntil)
+	}
+	if LegalHold {
+		input.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
+	}
+	return nil
+}
+
+// Explain a failed delete or overwrite of an object that is under retention or a legal hold
+func explainLocked(client *s3.S3, bucket string, key string, err error) error {
+	if !isErrCode(err, "AccessDenied") {
+		return err
+	}
+	input := &s3.GetObjectRetentionInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if retention, rerr := client.GetObjectRetention(input); rerr == nil && retention.Retention != nil {
+		until := aws.TimeValue(retention.Retention.RetainUntilDate)
+		if until.After(time.Now()) {
+			return fmt.Errorf("%w (object is retained in %s mode until %s)",
+				err, aws.StringValue(retention.Retention.Mode), until.Format(time.RFC3339))
+		}
+	}
+	hold, herr := client.GetObjectLegalHold(&s3.GetObjectLegalHoldInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if herr == nil && hold.LegalHold != nil && aws.StringValue(hold.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn {
+		return fmt.Errorf("%w (object is under a legal hold)", err)
+	}
+	return err
+}
+
+// Report whether err is an AWS error with the given code
+func isErrCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"golang.org/x/exp/slices"
+)
+
+// Settings for written objects from `-output-storage-class`, `-output-tag` and `-output-acl`
+var (
+	OutputStorageClass string
+	OutputTags         stringList
+	OutputACL          string
+)
+
+// Object ownership setting of each destination bucket, empty when it cannot be read
+var ownership = map[string]string{}
+
+// Check the output settings before anything is written
+func checkOutputSettings() error {
+	if OutputStorageClass != "" && !slices.Contains(s3.StorageClass_Values(), OutputStorageClass) {
+		return fmt.Errorf("unknown storage class %q, expected one of %s", OutputStorageClass, strings.Join(s3.StorageClass_Values(), ", "))
+	}
+	if OutputACL != "" && !slices.Contains(s3.ObjectCannedACL_Values(), OutputACL) {
+		return fmt.Errorf("unknown canned ACL %q, expected one of %s", OutputACL, strings.Join(s3.ObjectCannedACL_Values(), ", "))
+	}
+	for _, tag := range OutputTags {
+		if name, _, ok := strings.Cut(tag, "="); !ok || name == "" {
+			return fmt.Errorf("tag %q is not of the form `key=value`", tag)
+		}
+	}
+	return nil
+}
+
+// Apply the storage class and tags to an upload.
+// Tags are added to any the upload already carries, replacing those with the same key.
+func classifyUpload(input *s3manager.UploadInput) error {
+	if OutputStorageClass != "" {
+		input.StorageClass = aws.String(OutputStorageClass)
+	}
+	if len(OutputTags) == 0 {
+		return nil
+	}
+
+	tags, err := url.ParseQuery(aws.StringValue(input.Tagging))
+	if err != nil {
+		return err
+	}
+	for _, tag := range OutputTags {
+		name, value, _ := strings.Cut(tag, "=")
+		tags.Set(name, value)
+	}
+	input.Tagging = aws.String(tags.Encode())
+	return nil
+}
+
+// Return the object ownership setting of a bucket (`BucketOwnerEnforced`, `BucketOwnerPreferred` or `ObjectWriter`).
+// It is empty when the caller may not read it, typically because the bucket belongs to another account.
+func bucketOwnership(client *s3.S3, bucket string) string {
+	if setting, ok := ownership[bucket]; ok {
+		return setting
+	}
+	var setting string
+	controls, err := client.GetBucketOwnershipControls(&s3.GetBucketOwnershipControlsInput{Bucket: aws.String(bucket)})
+	if err == nil && controls.OwnershipControls != nil && len(controls.OwnershipControls.Rules) > 0 {
+		setting = aws.StringValue(controls.OwnershipControls.Rules[0].ObjectOwnership)
+	}
+	ownership[bucket] = setting
+	return setting
+}
+
+// Apply the canned ACL to an upload.
+// Without `-output-acl`, objects get `bucket-owner-full-control` only when the bucket is confirmed to keep objects
+// owned by their writer (`ObjectWriter`), so objects written into a partner's bucket are readable by its owner.
+// Buckets whose setting can't be read get no ACL, since it is rejected where ACLs are disabled.
+func grantUpload(client *s3.S3, input *s3manager.UploadInput) error {
+	bucket := aws.StringValue(input.Bucket)
+	setting := bucketOwnership(client, bucket)
+
+	switch {
+	case OutputACL == "" && setting == s3.ObjectOwnershipObjectWriter:
+		input.ACL = aws.String(s3.ObjectCannedACLBucketOwnerFullControl)
+	case OutputACL == "":
+	case setting == s3.ObjectOwnershipBucketOwnerEnforced && OutputACL != s3.ObjectCannedACLBucketOwnerFullControl:
+		return fmt.Errorf("bucket %s enforces object ownership, so ACLs are disabled and -output-acl %s cannot be applied", bucket, OutputACL)
+	default:
+		input.ACL = aws.String(OutputACL)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func TestGrantUpload(t *testing.T) {
+	defer func(acl string) { OutputACL = acl }(OutputACL)
+	ownership["writer"] = s3.ObjectOwnershipObjectWriter
+	ownership["preferred"] = s3.ObjectOwnershipBucketOwnerPreferred
+	ownership["enforced"] = s3.ObjectOwnershipBucketOwnerEnforced
+	ownership["denied"] = ""
+	for _, test := range []struct {
+		bucket, flag, want string
+		fails              bool
+	}{
+		{bucket: "writer", want: s3.ObjectCannedACLBucketOwnerFullControl},
+		{bucket: "preferred"},
+		{bucket: "enforced"},
+		{bucket: "denied"},
+		{bucket: "denied", flag: s3.ObjectCannedACLBucketOwnerFullControl, want: s3.ObjectCannedACLBucketOwnerFullControl},
+		{bucket: "writer", flag: s3.ObjectCannedACLPrivate, want: s3.ObjectCannedACLPrivate},
+		{bucket: "enforced", flag: s3.ObjectCannedACLBucketOwnerFullControl, want: s3.ObjectCannedACLBucketOwnerFullControl},
+		{bucket: "enforced", flag: s3.ObjectCannedACLPrivate, fails: true},
+	} {
+		OutputACL = test.flag
+		input := &s3manager.UploadInput{Bucket: aws.String(test.bucket)}
+		err := grantUpload(nil, input)
+		if (err != nil) != test.fails || aws.StringValue(input.ACL) != test.want {
+			t.Errorf("%s with -output-acl %q: got ACL %q, %v, want %q", test.bucket, test.flag, aws.StringValue(input.ACL), err, test.want)
+		}
+	}
+}
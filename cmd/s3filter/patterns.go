@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Collect the patterns of `-with-word-regex` and of the `-with-word-regex-file`, one per line.
+// Blank lines and lines starting with `#` in the file are skipped.
+func readPatterns(values []string, path string) ([]string, error) {
+	patterns := append([]string{}, values...)
+	if path == "" {
+		return patterns, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		patterns = append(patterns, text)
+	}
+	return patterns, scanner.Err()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"s3filter"
+)
+
+// Access policy loaded from `-policy`, a YAML file (JSON is YAML too), e.g.
+//
+//	fields: [id, time, type]
+//	types: [login, logout]
+//	deny_words: [internal]
+type Policy struct {
+	// Fields the caller may see. Every other field is stripped from the output.
+	// An empty list permits all fields.
+	Fields []string `yaml:"fields"`
+	// Record types the caller may see, the value of each record's TypeField.
+	// Records of any other type, or of none, are dropped. An empty list permits all types.
+	Types []string `yaml:"types"`
+	// The field holding the record type, `type` by default, or a JSON pointer such as `/meta/kind`.
+	TypeField string `yaml:"type_field"`
+	// Records whose `words` contain any of these values are dropped.
+	DenyWords []string `yaml:"deny_words"`
+
+	typePointer *s3filter.Pointers
+}
+
+// Policy audit counters; only records that matched count as dropped
+var (
+	PolicyDropped  int64
+	PolicyStripped int64
+)
+
+// Read and parse the policy file
+func loadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy Policy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	if policy.TypeField == "" {
+		policy.TypeField = "type"
+	}
+	policy.typePointer = s3filter.NewPointers([][]string{s3filter.ParsePointer(policy.TypeField)})
+	return &policy, nil
+}
+
+// Report whether the caller may see the record at all
+func (p *Policy) permits(record Record) bool {
+	for _, word := range p.DenyWords {
+		if slices.Contains(record.Words, word) {
+			return false
+		}
+	}
+	if len(p.Types) > 0 && !slices.Contains(p.Types, p.recordType(record)) {
+		return false
+	}
+	return true
+}
+
+// The type of a record, empty when it has none or it isn't a string
+func (p *Policy) recordType(record Record) string {
+	values, err := p.typePointer.Extract(record.Raw)
+	if err != nil || values[0] == nil {
+		return ""
+	}
+	var kind string
+	if json.Unmarshal(values[0], &kind) != nil {
+		return ""
+	}
+	return kind
+}
+
+// Remove fields the caller may not see
+func (p *Policy) strip(doc map[string]interface{}) {
+	if len(p.Fields) == 0 {
+		return
+	}
+	for field := range doc {
+		if !slices.Contains(p.Fields, field) {
+			delete(doc, field)
+			PolicyStripped++
+		}
+	}
+}
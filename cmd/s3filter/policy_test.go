@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := "# what the support team may see\nfields:\n  - id\n  - type\ntypes: [login, logout]\ndeny_words:\n  - internal\n"
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src := `{"id":1,"type":"login","user":"a"}
+{"id":2,"type":"purchase","user":"b"}
+{"id":3,"type":"logout","words":["internal"]}
+{"id":4,"user":"c"}
+{"id":5,"type":"logout","user":"d"}
+`
+	PolicyDropped, PolicyStripped = 0, 0
+	want := `{"id":1,"type":"login"}` + "\n" + `{"id":5,"type":"logout"}` + "\n"
+	if got := runFilter(t, src, "-policy", path); got != want {
+		t.Errorf("emitted %s, want %s", got, want)
+	}
+	if PolicyDropped != 3 || PolicyStripped != 2 {
+		t.Errorf("%d records dropped and %d fields stripped, want 3 and 2", PolicyDropped, PolicyStripped)
+	}
+}
+
+// Only records that match are counted as dropped by the policy, and denied ones aren't shown as context
+func TestPolicyAfterMatching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("types: [login]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src := `{"id":1,"type":"purchase","words":["error"]}
+{"id":2,"type":"purchase"}
+{"id":3,"type":"login"}
+{"id":4,"type":"login","words":["error"]}
+`
+	PolicyDropped = 0
+	got := runFilter(t, src, "-policy", path, "-with-word", "error", "-context", "2")
+	if want := `{"_context":true,"id":3,"type":"login"}` + "\n" + `{"id":4,"type":"login","words":["error"]}` + "\n"; got != want {
+		t.Errorf("emitted %s, want %s", got, want)
+	}
+	if PolicyDropped != 1 {
+		t.Errorf("%d records dropped, want the one matching record", PolicyDropped)
+	}
+}
+
+func TestPolicyTypeField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(`{"types": ["login"], "type_field": "/meta/kind"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src := `{"id":1,"meta":{"kind":"login"}}
+{"id":2,"meta":{"kind":"purchase"}}
+`
+	if got, want := runFilter(t, src, "-policy", path), `{"id":1,"meta":{"kind":"login"}}`+"\n"; got != want {
+		t.Errorf("emitted %s, want %s", got, want)
+	}
+}
+
+func TestPolicyUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("feilds: [id]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPolicy(path); err == nil {
+		t.Error("a policy with an unknown key loaded")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Destination buckets already checked
+var preflighted = map[string]bool{}
+
+// Check, once per destination bucket, that written objects will be readable by the bucket owner.
+// Problems are printed as warnings; the write itself is left to succeed or fail.
+func preflightOutput(sess *session.Session, client *s3.S3, bucket string, acl string) {
+	if preflighted[bucket] {
+		return
+	}
+	preflighted[bucket] = true
+	warn := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, "Warning: s3://%s: %s\n", bucket, fmt.Sprintf(format, args...))
+	}
+
+	// A bucket in another account refuses HeadBucket when the caller's account is given as the expected owner
+	crossAccount := false
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err == nil {
+		_, err = client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket), ExpectedBucketOwner: identity.Account})
+		if err != nil {
+			_, headErr := client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+			crossAccount = headErr == nil
+		}
+	}
+
+	setting := bucketOwnership(client, bucket)
+	if crossAccount && setting != s3.ObjectOwnershipBucketOwnerEnforced && acl != s3.ObjectCannedACLBucketOwnerFullControl {
+		warn("bucket belongs to another account and objects written with ACL %q stay owned by %s, so the bucket owner may not be able to read them; "+
+			"pass `-output-acl bucket-owner-full-control` to grant it", acl, aws.StringValue(identity.Account))
+	}
+
+	encryption, err := client.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if err != nil || encryption.ServerSideEncryptionConfiguration == nil {
+		return
+	}
+	for _, rule := range encryption.ServerSideEncryptionConfiguration.Rules {
+		sse := rule.ApplyServerSideEncryptionByDefault
+		if sse == nil || aws.StringValue(sse.SSEAlgorithm) != s3.ServerSideEncryptionAwsKms {
+			continue
+		}
+
+		keyID := aws.StringValue(sse.KMSMasterKeyID)
+		if keyID == "" {
+			keyID = "alias/aws/s3"
+		}
+		key, err := kms.New(sess).DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+		if err != nil {
+			warn("default KMS key %s cannot be used by this identity, writes may be rejected: %v", keyID, err)
+			continue
+		}
+		metadata := key.KeyMetadata
+		if aws.StringValue(metadata.KeyState) != kms.KeyStateEnabled {
+			warn("default KMS key %s is %s, writes will be rejected", keyID, aws.StringValue(metadata.KeyState))
+		}
+		if crossAccount && aws.StringValue(metadata.KeyManager) == kms.KeyManagerTypeAws {
+			warn("objects are encrypted with the AWS managed key %s, which the bucket owner's account cannot use to decrypt them", keyID)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Set by `-profile-report`: the directory the CPU and heap profiles and their summary are written to
+var ProfileDir string
+
+// The CPU profile being recorded, nil when there is none
+var (
+	cpuProfile   *os.File
+	profileStart time.Time
+)
+
+// Functions listed in each section of the summary
+const profileTop = 25
+
+// Start CPU profiling into the `-profile-report` directory
+func startProfile() error {
+	if err := os.MkdirAll(ProfileDir, 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(ProfileDir, "cpu.pprof"))
+	if err != nil {
+		return err
+	}
+	if err = pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+	cpuProfile, profileStart = file, time.Now()
+	return nil
+}
+
+// Stop profiling and write the heap profile and `summary.txt`; failures to do so are only warned about
+func finishProfile() {
+	if cpuProfile == nil {
+		return
+	}
+	pprof.StopCPUProfile()
+	cpuProfile.Close()
+	cpuProfile = nil
+
+	if err := writeProfileReport(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write the profile report to %s %v\n", ProfileDir, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Profile report written to %s\n", ProfileDir)
+}
+
+func writeProfileReport() error {
+	heap, err := os.Create(filepath.Join(ProfileDir, "heap.pprof"))
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err = pprof.WriteHeapProfile(heap); err != nil {
+		heap.Close()
+		return err
+	}
+	if err = heap.Close(); err != nil {
+		return err
+	}
+
+	var summary bytes.Buffer
+	fmt.Fprintf(&summary, "s3filter %s\n", os.Args[1:])
+	fmt.Fprintf(&summary, "%s, GOMAXPROCS %d, %v wall time, %d of %d records matched\n",
+		runtime.Version(), runtime.GOMAXPROCS(0), time.Since(profileStart).Round(time.Millisecond), Matched, Scanned)
+	for _, section := range []struct {
+		title, file, sampleType string
+	}{
+		{"CPU time", "cpu.pprof", "cpu"},
+		{"Allocated bytes", "heap.pprof", "alloc_space"},
+		{"In-use bytes at exit", "heap.pprof", "inuse_space"},
+	} {
+		file, err := os.Open(filepath.Join(ProfileDir, section.file))
+		if err != nil {
+			return err
+		}
+		prof, err := profile.Parse(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", section.file, err)
+		}
+		fmt.Fprintf(&summary, "\n%s (%s)\n", section.title, section.file)
+		top(&summary, prof, section.sampleType, profileTop)
+	}
+	return os.WriteFile(filepath.Join(ProfileDir, "summary.txt"), summary.Bytes(), 0644)
+}
+
+// Print the functions with the largest flat (own) values of a sample type, with their cumulative values
+func top(w io.Writer, p *profile.Profile, sampleType string, n int) {
+	index := -1
+	for i, t := range p.SampleType {
+		if t.Type == sampleType {
+			index = i
+		}
+	}
+	if index < 0 {
+		fmt.Fprintf(w, "no %s samples\n", sampleType)
+		return
+	}
+
+	flat, cum := map[string]int64{}, map[string]int64{}
+	var total int64
+	for _, s := range p.Sample {
+		value := s.Value[index]
+		total += value
+		seen := map[string]bool{}
+		for i, location := range s.Location {
+			// inlined functions come first
+			for j, line := range location.Line {
+				fn := "?"
+				if line.Function != nil {
+					fn = line.Function.Name
+				}
+				if i == 0 && j == 0 {
+					flat[fn] += value
+				}
+				if !seen[fn] {
+					seen[fn] = true
+					cum[fn] += value
+				}
+			}
+		}
+	}
+	if total == 0 {
+		fmt.Fprintf(w, "no %s samples\n", sampleType)
+		return
+	}
+
+	functions := make([]string, 0, len(cum))
+	for fn := range cum {
+		functions = append(functions, fn)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if flat[functions[i]] != flat[functions[j]] {
+			return flat[functions[i]] > flat[functions[j]]
+		}
+		return cum[functions[i]] > cum[functions[j]]
+	})
+	if len(functions) > n {
+		functions = functions[:n]
+	}
+
+	format := func(v int64) string {
+		if sampleType == "cpu" {
+			return time.Duration(v).Round(time.Millisecond).String()
+		}
+		return fmt.Sprintf("%.1fMB", float64(v)/(1<<20))
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "flat\tflat%%\tcum\tcum%%\t\n")
+	for _, fn := range functions {
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%s\t%.1f%%\t  %s\n", format(flat[fn]), 100*float64(flat[fn])/float64(total), format(cum[fn]), 100*float64(cum[fn])/float64(total), fn)
+	}
+	fmt.Fprintf(tw, "%s\ttotal\t\t\t\n", format(total))
+	tw.Flush()
+}
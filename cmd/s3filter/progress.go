@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Download progress tracker, set by `-progress`
+var Tracker *Progress
+
+// Progress of the bytes transferred for the current object and the whole run,
+// printed to stderr every second with throughput and ETA estimates.
+type Progress struct {
+	mu          sync.Mutex
+	planned     bool
+	total       int64
+	done        int64
+	start       time.Time
+	object      string
+	objectSize  int64
+	objectDone  int64
+	objectStart time.Time
+	stop        chan struct{}
+}
+
+func newProgress() *Progress {
+	p := &Progress{start: time.Now(), stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.print()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Add the size of an object that will be processed later in the run to the overall total
+func (p *Progress) expect(size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.planned = true
+	p.total += size
+}
+
+// Start tracking a new object
+func (p *Progress) begin(name string, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.planned {
+		p.total += size
+	}
+	p.object = name
+	p.objectSize = size
+	p.objectDone = 0
+	p.objectStart = time.Now()
+}
+
+// Count transferred bytes
+func (p *Progress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	p.objectDone += n
+}
+
+// Stop reporting and print the final state
+func (p *Progress) close() {
+	close(p.stop)
+	p.print()
+	fmt.Fprintln(os.Stderr)
+}
+
+func (p *Progress) print() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	line := fmt.Sprintf("%s: %s", p.object, estimate(p.objectDone, p.objectSize, time.Since(p.objectStart)))
+	if p.total != p.objectSize {
+		line += fmt.Sprintf(" (overall %s)", estimate(p.done, p.total, time.Since(p.start)))
+	}
+	fmt.Fprintf(os.Stderr, "\r%s\033[K", line)
+}
+
+// Describe progress as percentage, throughput and remaining time
+func estimate(done int64, total int64, elapsed time.Duration) string {
+	if total <= 0 {
+		return fmt.Sprintf("%.1f MB", float64(done)/1e6)
+	}
+
+	percent := 100 * float64(done) / float64(total)
+	rate := float64(done) / elapsed.Seconds()
+	if rate <= 0 {
+		return fmt.Sprintf("%.1f%% of %.1f MB", percent, float64(total)/1e6)
+	}
+
+	eta := time.Duration(float64(total-done) / rate * float64(time.Second))
+	return fmt.Sprintf("%.1f%% of %.1f MB, %.1f MB/s, ETA %v", percent, float64(total)/1e6, rate/1e6, eta.Round(time.Second))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"s3filter"
+)
+
+// Report whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Ask on the terminal for the object to filter when `-input` is missing.
+// A blank answer lists the buckets, a prefix ending in `/` lists what is under it, a partial bucket or key lists its completions,
+// and a number picks an entry of the last listing.
+func promptInput(client *s3.S3, in io.Reader, out io.Writer) (string, error) {
+	scanner := bufio.NewScanner(in)
+	var choices []string
+	for {
+		fmt.Fprint(out, "Input s3://{bucket}/{key} (blank lists buckets, Ctrl-D quits): ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		entry := strings.TrimSpace(scanner.Text())
+		if n, err := strconv.Atoi(entry); err == nil {
+			if n < 1 || n > len(choices) {
+				fmt.Fprintf(out, "No entry %d\n", n)
+				continue
+			}
+			entry = choices[n-1]
+		}
+
+		candidates, exact, err := complete(client, entry)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		if exact {
+			fmt.Fprintln(out, entry)
+			return entry, nil
+		}
+		if len(candidates) == 0 {
+			fmt.Fprintf(out, "Nothing matches %s\n", entry)
+			continue
+		}
+		choices = candidates
+		for i, choice := range choices {
+			fmt.Fprintf(out, "%4d  %s\n", i+1, choice)
+		}
+	}
+}
+
+// List the completions of a partial S3 URI, reporting whether it names an existing object
+func complete(client *s3.S3, entry string) ([]string, bool, error) {
+	rest := strings.TrimPrefix(entry, "s3://")
+	if !strings.Contains(rest, "/") {
+		// complete the bucket name
+		buckets, err := client.ListBuckets(&s3.ListBucketsInput{})
+		if err != nil {
+			return nil, false, err
+		}
+		var candidates []string
+		for _, bucket := range buckets.Buckets {
+			if name := aws.StringValue(bucket.Name); strings.HasPrefix(name, rest) {
+				candidates = append(candidates, "s3://"+name+"/")
+			}
+		}
+		return candidates, false, nil
+	}
+
+	bucket, prefix, err := s3filter.ParsePrefix("s3://" + rest)
+	if err != nil {
+		return nil, false, err
+	}
+	// one level at a time, like a directory listing
+	page, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	var candidates []string
+	for _, common := range page.CommonPrefixes {
+		candidates = append(candidates, "s3://"+bucket+"/"+aws.StringValue(common.Prefix))
+	}
+	for _, object := range page.Contents {
+		key := aws.StringValue(object.Key)
+		if key == prefix && prefix != "" && !strings.HasSuffix(key, "/") {
+			return nil, true, nil
+		}
+		if !strings.HasSuffix(key, "/") {
+			candidates = append(candidates, "s3://"+bucket+"/"+key)
+		}
+	}
+	return candidates, false, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"s3filter"
+)
+
+// Root of the prefixes `sync -atomic` stages filtered objects under.
+// It sits beside any destination prefix, and loaders skip keys starting with `.` like hidden files.
+const stagingRoot = ".s3filter-staging/"
+
+// Largest object published with a single CopyObject, beyond which it is copied in parts
+const maxCopySize = 5 << 30
+
+// Size of the parts larger objects are published in
+var copyPartSize int64 = 512 << 20
+
+// Return the prefix a run started at start stages the objects of a destination prefix under
+func stagingPrefix(dstPrefix string, start time.Time) string {
+	return stagingRoot + start.UTC().Format("20060102T150405.000000000Z") + "/" + dstPrefix
+}
+
+// Copy a staged object to its destination key, within the bucket.
+// Staged objects carry their metadata and tags, but not the retention or storage class, which apply to the published copy.
+func publishObject(sess *session.Session, bucket string, staged string, key string) error {
+	client := s3.New(sess)
+	settings := &s3manager.UploadInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if err := lockUpload(client, settings); err != nil {
+		return err
+	}
+	if OutputStorageClass != "" {
+		settings.StorageClass = aws.String(OutputStorageClass)
+	}
+	if err := grantUpload(client, settings); err != nil {
+		return err
+	}
+	preflightOutput(sess, client, bucket, aws.StringValue(settings.ACL))
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(staged)})
+	if err != nil {
+		return err
+	}
+	source := (&url.URL{Path: bucket + "/" + staged}).EscapedPath()
+	size := aws.Int64Value(head.ContentLength)
+
+	if size <= maxCopySize {
+		_, err = client.CopyObject(&s3.CopyObjectInput{
+			Bucket:                    settings.Bucket,
+			Key:                       settings.Key,
+			CopySource:                aws.String(source),
+			CopySourceIfMatch:         head.ETag,
+			MetadataDirective:         aws.String(s3.MetadataDirectiveCopy),
+			TaggingDirective:          aws.String(s3.TaggingDirectiveCopy),
+			ACL:                       settings.ACL,
+			StorageClass:              settings.StorageClass,
+			ObjectLockMode:            settings.ObjectLockMode,
+			ObjectLockRetainUntilDate: settings.ObjectLockRetainUntilDate,
+			ObjectLockLegalHoldStatus: settings.ObjectLockLegalHoldStatus,
+		})
+		if err != nil {
+			return explainLocked(client, bucket, key, err)
+		}
+		return nil
+	}
+
+	// a multipart copy doesn't carry over the metadata and tags, so they are given again
+	tagging, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String(bucket), Key: aws.String(staged)})
+	if err != nil {
+		return err
+	}
+	tags := url.Values{}
+	for _, tag := range tagging.TagSet {
+		tags.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:                    settings.Bucket,
+		Key:                       settings.Key,
+		ContentType:               head.ContentType,
+		ContentEncoding:           head.ContentEncoding,
+		Metadata:                  head.Metadata,
+		ACL:                       settings.ACL,
+		StorageClass:              settings.StorageClass,
+		ObjectLockMode:            settings.ObjectLockMode,
+		ObjectLockRetainUntilDate: settings.ObjectLockRetainUntilDate,
+		ObjectLockLegalHoldStatus: settings.ObjectLockLegalHoldStatus,
+	}
+	if len(tags) > 0 {
+		create.Tagging = aws.String(tags.Encode())
+	}
+	upload, err := client.CreateMultipartUpload(create)
+	if err != nil {
+		return explainLocked(client, bucket, key, err)
+	}
+
+	var parts []*s3.CompletedPart
+	for offset := int64(0); offset < size; offset += copyPartSize {
+		end := offset + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		part, err := client.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:            settings.Bucket,
+			Key:               settings.Key,
+			UploadId:          upload.UploadId,
+			PartNumber:        aws.Int64(int64(len(parts) + 1)),
+			CopySource:        aws.String(source),
+			CopySourceIfMatch: head.ETag,
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{Bucket: settings.Bucket, Key: settings.Key, UploadId: upload.UploadId})
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int64(int64(len(parts) + 1))})
+	}
+	_, err = client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          settings.Bucket,
+		Key:             settings.Key,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{Bucket: settings.Bucket, Key: settings.Key, UploadId: upload.UploadId})
+		return err
+	}
+	return nil
+}
+
+// Delete the objects staged under a prefix.
+// Failures are only warned about: whatever is left is never published, and can be removed later.
+func discardStaged(client *s3.S3, bucket string, prefix string) {
+	objects, err := s3filter.ListObjects(client, bucket, prefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to list staged objects under s3://%s/%s %v\n", bucket, prefix, err)
+		return
+	}
+	for _, object := range objects {
+		_, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: object.Key})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to delete staged object s3://%s/%s %v\n", bucket, aws.StringValue(object.Key), err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestStagingPrefix(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 5, time.FixedZone("CET", 3600))
+	if got, want := stagingPrefix("out/", start), ".s3filter-staging/20240301T090000.000000005Z/out/"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// A staged object is copied to its key with the retention, storage class and ACL, in parts beyond the CopyObject limit
+func TestPublishObject(t *testing.T) {
+	defer func(class string) { OutputStorageClass = class }(OutputStorageClass)
+	defer func(size int64) { copyPartSize = size }(copyPartSize)
+	OutputStorageClass = s3.StorageClassStandardIa
+	copyPartSize = 2 << 30
+	ownership["bucket"] = s3.ObjectOwnershipObjectWriter
+	preflighted["bucket"] = true
+
+	var size int64
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		query := r.URL.Query()
+		request := r.Method + " " + r.URL.Path
+		for _, header := range []string{"X-Amz-Copy-Source", "X-Amz-Copy-Source-Range", "X-Amz-Metadata-Directive",
+			"X-Amz-Tagging-Directive", "X-Amz-Storage-Class", "X-Amz-Acl", "X-Amz-Tagging", "X-Amz-Meta-S3filter-Criteria"} {
+			if value := r.Header.Get(header); value != "" {
+				request += fmt.Sprintf(" %s=%s", strings.ToLower(header), value)
+			}
+		}
+		requests = append(requests, request)
+
+		switch {
+		case r.Method == http.MethodHead:
+			w.Header().Set("Content-Length", fmt.Sprint(size))
+			w.Header().Set("ETag", `"staged"`)
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("X-Amz-Meta-S3filter-Criteria", "digest")
+		case query.Has("tagging"):
+			io.WriteString(w, `<Tagging><TagSet><Tag><Key>team</Key><Value>data</Value></Tag></TagSet></Tagging>`)
+		case query.Has("uploads"):
+			io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>`)
+		case query.Has("partNumber"):
+			fmt.Fprintf(w, `<CopyPartResult><ETag>"part%s"</ETag></CopyPartResult>`, query.Get("partNumber"))
+		case query.Has("uploadId"):
+			io.WriteString(w, `<CompleteMultipartUploadResult><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+		default:
+			io.WriteString(w, `<CopyObjectResult><ETag>"copied"</ETag></CopyObjectResult>`)
+		}
+	}))
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		size int64
+		want []string
+	}{
+		{1000, []string{
+			"HEAD /bucket/.stage/a b.json",
+			"PUT /bucket/out/a b.json x-amz-copy-source=bucket/.stage/a%20b.json x-amz-metadata-directive=COPY " +
+				"x-amz-tagging-directive=COPY x-amz-storage-class=STANDARD_IA x-amz-acl=bucket-owner-full-control",
+		}},
+		{5<<30 + 1, []string{
+			"HEAD /bucket/.stage/a b.json",
+			"GET /bucket/.stage/a b.json",
+			"POST /bucket/out/a b.json x-amz-storage-class=STANDARD_IA x-amz-acl=bucket-owner-full-control " +
+				"x-amz-tagging=team=data x-amz-meta-s3filter-criteria=digest",
+			"PUT /bucket/out/a b.json x-amz-copy-source=bucket/.stage/a%20b.json x-amz-copy-source-range=bytes=0-2147483647",
+			"PUT /bucket/out/a b.json x-amz-copy-source=bucket/.stage/a%20b.json x-amz-copy-source-range=bytes=2147483648-4294967295",
+			"PUT /bucket/out/a b.json x-amz-copy-source=bucket/.stage/a%20b.json x-amz-copy-source-range=bytes=4294967296-5368709120",
+			"POST /bucket/out/a b.json",
+		}},
+	} {
+		size, requests = test.size, nil
+		if err := publishObject(sess, "bucket", ".stage/a b.json", "out/a b.json"); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(requests, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%d bytes: got requests\n%s\nwant\n%s", test.size, strings.Join(requests, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
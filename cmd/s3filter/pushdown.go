@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"s3filter"
+)
+
+// Set by `-pushdown`: evaluate what the criteria allow server side with S3 Select
+var Pushdown *bool
+
+// Longer id lists stay local, keeping the expression well within the S3 Select size limit
+const maxPushdownIDs = 1000
+
+// Control characters valid JSON never holds unescaped, used as the CSV field delimiter and quote of S3 Select
+// so that each line of the object is one unquoted field, returned byte for byte as stored
+const (
+	lineDelimiter = "\x1f"
+	lineQuote     = "\x1e"
+)
+
+// Translate the criteria into an S3 Select expression over the lines of the object, or return "" when nothing can be pushed down.
+// The conditions are text every matching record contains, so the expression only narrows the records and every record it returns
+// is still filtered locally: the digits of one of its `-with-id` ids, and its `-with-word` words in quotes.
+// The time window, `-without-word` and `-with-word-regex` stay local, as S3 Select can't pick a field out of a line.
+func selectExpression() string {
+	var conditions []string
+
+	// records without an integer id have id 0, and no digits to find
+	if len(IDSet) > 0 && len(IDSet) <= maxPushdownIDs && !IDSet[0] {
+		ids := make([]int64, 0, len(IDSet))
+		for id := range IDSet {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		alternatives := make([]string, len(ids))
+		for i, id := range ids {
+			alternatives[i] = fmt.Sprintf("s._1 LIKE '%%%d%%'", id)
+		}
+		conditions = append(conditions, anyOf(alternatives))
+	}
+
+	var words []string
+	for _, word := range WithWords {
+		if !verbatimWord(word) {
+			if *WordMatch == "any" {
+				// the record may hold just that one
+				words = nil
+				break
+			}
+			continue
+		}
+		pattern := strings.NewReplacer(`%`, `\%`, `_`, `\_`, `'`, `''`).Replace(word)
+		words = append(words, fmt.Sprintf(`s._1 LIKE '%%"%s"%%' ESCAPE '\'`, pattern))
+	}
+	if len(words) > 0 && *WordMatch == "any" {
+		conditions = append(conditions, anyOf(words))
+	} else {
+		conditions = append(conditions, words...)
+	}
+
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "SELECT s._1 FROM S3Object s WHERE " + strings.Join(conditions, " AND ")
+}
+
+// Join alternative conditions, in parentheses when there are several
+func anyOf(alternatives []string) string {
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// Report whether every common JSON encoder writes a string as is between its quotes:
+// printable ASCII without `"` and `\`, nor the `/`, `<`, `>` and `&` some encoders escape
+func verbatimWord(word string) bool {
+	for _, c := range word {
+		if c < ' ' || c > '~' || strings.ContainsRune(`"\/<>&`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Report whether S3 Select may stand in for reading the whole object.
+// Checks, schema validation and context lines need the records that don't match, and S3 Select only reads UTF-8 NDJSON here.
+func canPushdown() bool {
+	return *Pushdown && *Format == "ndjson" && len(Checks) == 0 && Contract == nil && Context == nil &&
+		(*Encoding == "auto" || *Encoding == "utf-8")
+}
+
+// Open the records of an object that S3 Select returns for the pushed down criteria, or nil when the object is to be read in full:
+// when S3 Select can't read it (zstd), or the query fails before returning anything
+func openSelected(sess *session.Session, bucket string, key string) (io.ReadCloser, error) {
+	compression, err := selectCompression(sess, bucket, key)
+	if err != nil || compression == "" {
+		return nil, err
+	}
+	stream, err := selectObject(sess, bucket, key, compression, selectExpression())
+	if err == nil {
+		selected := &struct {
+			*bufio.Reader
+			io.Closer
+		}{bufio.NewReader(stream), stream}
+		if _, err = selected.Peek(1); err == nil || err == io.EOF {
+			return selected, nil
+		}
+		stream.Close()
+	}
+	incident("S3 Select of s3://%s/%s failed, reading the whole object: %v", bucket, key, err)
+	return nil, nil
+}
+
+// The S3 Select compression type of an object, detected from its first bytes with a ranged GET as a download detects it,
+// or "" when S3 Select can't read it (zstd)
+func selectCompression(sess *session.Session, bucket string, key string) (string, error) {
+	if NoDecompress {
+		return s3.CompressionTypeNone, nil
+	}
+	object, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String("bytes=0-3"),
+	})
+	if isErrCode(err, "InvalidRange") {
+		// an empty object
+		return s3.CompressionTypeNone, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer object.Body.Close()
+	head, err := io.ReadAll(object.Body)
+	if err != nil {
+		return "", err
+	}
+	switch s3filter.Detect(head, key) {
+	case s3filter.Gzip:
+		return s3.CompressionTypeGzip, nil
+	case s3filter.Bzip2:
+		return s3.CompressionTypeBzip2, nil
+	case s3filter.Zstd:
+		return "", nil
+	}
+	return s3.CompressionTypeNone, nil
+}
+
+// Run an S3 Select query over the lines of an object compressed as selectCompression found, and stream the selected lines
+func selectObject(sess *session.Session, bucket string, key string, compression string, expression string) (io.ReadCloser, error) {
+	return transfer().Watch(context.Background(), func(ctx context.Context) (io.ReadCloser, error) {
+		resp, err := s3.New(sess).SelectObjectContentWithContext(ctx, &s3.SelectObjectContentInput{
+			Bucket:         aws.String(bucket),
+			Key:            aws.String(key),
+			Expression:     aws.String(expression),
+			ExpressionType: aws.String(s3.ExpressionTypeSql),
+			InputSerialization: &s3.InputSerialization{
+				CompressionType: aws.String(compression),
+				CSV: &s3.CSVInput{
+					FileHeaderInfo:       aws.String(s3.FileHeaderInfoNone),
+					RecordDelimiter:      aws.String("\n"),
+					FieldDelimiter:       aws.String(lineDelimiter),
+					QuoteCharacter:       aws.String(lineQuote),
+					QuoteEscapeCharacter: aws.String(lineQuote),
+				},
+			},
+			OutputSerialization: &s3.OutputSerialization{
+				CSV: &s3.CSVOutput{
+					RecordDelimiter: aws.String("\n"),
+					FieldDelimiter:  aws.String(lineDelimiter),
+					QuoteCharacter:  aws.String(lineQuote),
+					QuoteFields:     aws.String(s3.QuoteFieldsAsneeded),
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		reader, writer := io.Pipe()
+		go func() {
+			stream := resp.GetStream()
+			defer stream.Close()
+			for event := range stream.Events() {
+				switch e := event.(type) {
+				case *s3.RecordsEvent:
+					if _, err := writer.Write(e.Payload); err != nil {
+						return
+					}
+				case *s3.StatsEvent:
+					meterSelect(e.Details)
+				}
+			}
+			writer.CloseWithError(stream.Err())
+		}()
+		return reader, nil
+	})
+}
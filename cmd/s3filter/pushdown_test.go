@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestSelectExpression(t *testing.T) {
+	const query = "SELECT s._1 FROM S3Object s WHERE "
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"-from-time", "2024-01-01", "-to-time", "2024-01-02"}, ""},
+		{[]string{"-with-id", "42"}, query + `s._1 LIKE '%42%'`},
+		{[]string{"-with-id", "7,-3", "-with-id", "7"}, query + `(s._1 LIKE '%-3%' OR s._1 LIKE '%7%')`},
+		// records without an id match -with-id 0
+		{[]string{"-with-id", "0,5"}, ""},
+		{[]string{"-with-word", "error"}, query + `s._1 LIKE '%"error"%' ESCAPE '\'`},
+		{[]string{"-with-word", "disk_full", "-with-word", "50%"}, query + `s._1 LIKE '%"disk\_full"%' ESCAPE '\' AND s._1 LIKE '%"50\%"%' ESCAPE '\'`},
+		{[]string{"-with-word", "it's"}, query + `s._1 LIKE '%"it''s"%' ESCAPE '\'`},
+		{[]string{"-with-word", "a", "-with-word", "b", "-word-match", "any"}, query + `(s._1 LIKE '%"a"%' ESCAPE '\' OR s._1 LIKE '%"b"%' ESCAPE '\')`},
+		// words encoders may escape stay local; with -word-match any, so do the others
+		{[]string{"-with-word", "a/b", "-with-word", "été", "-with-word", "ok"}, query + `s._1 LIKE '%"ok"%' ESCAPE '\'`},
+		{[]string{"-with-word", "ok", "-with-word", "<br>", "-word-match", "any"}, ""},
+		{[]string{"-with-word", `say "hi"`}, ""},
+		{[]string{"-with-id", "42", "-with-word", "error", "-without-word", "debug", "-with-word-regex", "^e"},
+			query + `s._1 LIKE '%42%' AND s._1 LIKE '%"error"%' ESCAPE '\'`},
+	} {
+		runFilter(t, "", test.args...)
+		if got := selectExpression(); got != test.want {
+			t.Errorf("%q: got %s, want %s", test.args, got, test.want)
+		}
+	}
+}
+
+// A failing S3 Select falls back to reading the whole object
+func TestPushdownFallback(t *testing.T) {
+	object := `{"id":1,"words":["error"],"n":1.50}` + "\n" + `{"id":2,"words":["info"]}` + "\n"
+	var selects int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["select"]; ok {
+			atomic.AddInt32(&selects, 1)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `<Error><Code>OverMaxRecordSize</Code><Message>too long</Message></Error>`)
+			return
+		}
+		offset, end := 0, len(object)-1
+		if spec := r.Header.Get("Range"); spec != "" {
+			fmt.Sscanf(spec, "bytes=%d-%d", &offset, &end)
+			end = min(end, len(object)-1)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end, len(object)))
+			w.Header().Set("Content-Length", fmt.Sprint(end+1-offset))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", fmt.Sprint(len(object)))
+		}
+		if r.Method != http.MethodHead {
+			io.WriteString(w, object[offset:end+1])
+		}
+	}))
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runFilter(t, "", "-pushdown", "-with-word", "error")
+	var out bytes.Buffer
+	Output = &out
+	Incidents = nil
+	if err = filterObject(sess, "s3://bucket/key.json"); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"id":1,"words":["error"],"n":1.50}` + "\n"; out.String() != want || selects != 1 {
+		t.Errorf("got %q after %d selects, want %q", out.String(), selects, want)
+	}
+	if len(Incidents) != 1 || !strings.Contains(Incidents[0], "reading the whole object") {
+		t.Errorf("incidents %q, want the fallback", Incidents)
+	}
+}
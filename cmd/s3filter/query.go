@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// Set by `-query`: a JMESPath expression a record's document must satisfy
+var Query *jmespath.JMESPath
+
+// Report whether the `-query` expression yields a true value for a record's document:
+// anything but false, null, and empty strings, arrays and objects, as JMESPath filters decide
+func queryMatches(record Record) bool {
+	if Query == nil {
+		return true
+	}
+	var doc interface{}
+	if json.Unmarshal(record.Raw, &doc) != nil {
+		return false
+	}
+	result, err := Query.Search(doc)
+	if err != nil {
+		return false
+	}
+	switch v := result.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package main
+
+import "runtime"
+
+// Set by `-download-concurrency`: the ranged GETs of an object in flight at once, sized by the `-mode` preset when 0
+var DownloadConcurrency int
+
+// Bytes fetched by each ranged GET of a streamed download, unless the memory limit calls for less
+const rangePartSize = 8 << 20
+
+// The ranged GETs in flight and the bytes each fetches: the `-download-concurrency`, or else
+// the `-mode` preset's per usable CPU, within `-max-connections`, with the parts held at once
+// (one per GET) kept within a quarter of the memory limit
+func downloadSizing() (concurrency int, partSize int64) {
+	concurrency = DownloadConcurrency
+	if concurrency <= 0 {
+		concurrency = min(Preset.concurrencyPerCPU*runtime.GOMAXPROCS(0), Preset.maxConcurrency)
+	}
+	if MaxConnections > 0 {
+		concurrency = min(concurrency, MaxConnections)
+	}
+	partSize = rangePartSize
+	if Resources.Memory > 0 {
+		partSize = min(partSize, max(Resources.Memory/4/int64(concurrency), 1<<20))
+	}
+	return concurrency, partSize
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expected record volume per time bucket, parsed from `-expect-rate`
+// such as `1000±20%/hour` (`+-` may be used in place of `±`).
+type RateExpectation struct {
+	Expected  float64
+	Tolerance float64
+	Bucket    time.Duration
+
+	counts map[time.Time]int64
+}
+
+// Parse an `-expect-rate` specification
+func parseRate(spec string) (*RateExpectation, error) {
+	amount, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %q, expected {count}±{percent}%%/{unit}", spec)
+	}
+
+	rate := &RateExpectation{counts: make(map[time.Time]int64)}
+	switch unit {
+	case "minute":
+		rate.Bucket = time.Minute
+	case "hour":
+		rate.Bucket = time.Hour
+	case "day":
+		rate.Bucket = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("unsupported rate unit %q", unit)
+	}
+
+	amount = strings.Replace(amount, "+-", "±", 1)
+	count, tolerance, _ := strings.Cut(amount, "±")
+
+	var err error
+	if rate.Expected, err = strconv.ParseFloat(count, 64); err != nil {
+		return nil, fmt.Errorf("invalid rate %q: %v", spec, err)
+	}
+	if tolerance != "" {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(tolerance, "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate tolerance %q: %v", spec, err)
+		}
+		rate.Tolerance = percent / 100
+	}
+	return rate, nil
+}
+
+// Count a record in its time bucket
+func (r *RateExpectation) add(t time.Time) {
+	r.counts[t.UTC().Truncate(r.Bucket)]++
+}
+
+// Return a description of every bucket outside the expected range.
+// Empty buckets between the first and last seen (or the `-from-time`/`-to-time` window) are anomalies too.
+func (r *RateExpectation) anomalies(from, to time.Time) []string {
+	if len(r.counts) == 0 && (from.IsZero() || to.IsZero()) {
+		return nil
+	}
+
+	buckets := make([]time.Time, 0, len(r.counts))
+	for bucket := range r.counts {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+
+	first, last := from.UTC().Truncate(r.Bucket), to.UTC().Truncate(r.Bucket)
+	if from.IsZero() {
+		first = buckets[0]
+	}
+	if to.IsZero() {
+		last = buckets[len(buckets)-1]
+	}
+
+	low, high := r.Expected*(1-r.Tolerance), r.Expected*(1+r.Tolerance)
+	var found []string
+	for bucket := first; !bucket.After(last); bucket = bucket.Add(r.Bucket) {
+		count := float64(r.counts[bucket])
+		if count < low || count > high {
+			found = append(found, fmt.Sprintf("%s: %d records (expected %.0f-%.0f)", bucket.Format(time.RFC3339), r.counts[bucket], low, high))
+		}
+	}
+	return found
+}
+
+// Print the anomalies to stderr and return them for the run summary
+func reportRate(rate *RateExpectation) []string {
+	found := rate.anomalies(FromTime, ToTime)
+	if len(found) == 0 {
+		fmt.Fprintln(os.Stderr, "Record volume: no anomalies")
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Record volume: %d anomalous buckets\n", len(found))
+	for _, anomaly := range found {
+		fmt.Fprintln(os.Stderr, "  "+anomaly)
+	}
+	return found
+}
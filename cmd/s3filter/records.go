@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Records skipped by `-max-record-bytes`
+var Oversized int64
+
+// Bytes of an oversized record written to the dead letter file at a time
+const deadLetterChunk = 64 << 10
+
+// Iterate over the JSON values of src without decoding them, returning each
+// raw value and its byte offset. Values larger than max bytes are never held
+// in memory: they are skipped and reported on stderr (and streamed to the
+// dead letter file, if any, in chunks) instead of being handed to the decoder.
+// Skipped values are counted as they are read, so records are decoded on the calling goroutine.
+func boundedRecords(src io.Reader, max int64) func() (json.RawMessage, int64, error) {
+	r := bufio.NewReader(src)
+	var pos int64
+	var index int64 // of the value, skipped ones included
+	return func() (json.RawMessage, int64, error) {
+		for {
+			// Skip whitespace between values
+			var c byte
+			var err error
+			for {
+				if c, err = r.ReadByte(); err != nil {
+					return nil, pos, err
+				}
+				pos++
+				if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+					break
+				}
+			}
+			start := pos - 1
+			index++
+
+			raw := []byte{c}
+			size := int64(1)
+			oversized := false
+			var chunk []byte  // of an oversized record, not yet dead-lettered
+			var deadErr error // the first failed write to the dead letter file
+			keep := func(c byte) {
+				size++
+				if oversized {
+					if DeadLetter != nil && deadErr == nil {
+						chunk = append(chunk, c)
+						if len(chunk) == deadLetterChunk {
+							deadErr = deadLetter(chunk)
+							chunk = chunk[:0]
+						}
+					}
+					return
+				}
+				raw = append(raw, c)
+				if int64(len(raw)) > max {
+					oversized = true
+					if DeadLetter != nil {
+						deadErr = deadLetter(raw)
+						chunk = make([]byte, 0, deadLetterChunk)
+					}
+					raw = nil
+				}
+			}
+
+			// Track structure until the value ends; syntax checking is left to the decoder
+			depth, inString, escaped := 0, false, false
+			switch c {
+			case '{', '[':
+				depth = 1
+			case '"':
+				inString = true
+			}
+			done := false
+			for !done {
+				if c, err = r.ReadByte(); err != nil {
+					if err == io.EOF && depth == 0 && !inString {
+						break
+					}
+					if err == io.EOF {
+						err = fmt.Errorf("unexpected end of JSON input")
+					}
+					return nil, start, err
+				}
+				pos++
+
+				switch {
+				case inString:
+					keep(c)
+					switch {
+					case escaped:
+						escaped = false
+					case c == '\\':
+						escaped = true
+					case c == '"':
+						inString = false
+						done = depth == 0
+					}
+				case depth == 0 && (c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+					// end of a scalar
+					done = true
+				default:
+					keep(c)
+					switch c {
+					case '"':
+						inString = true
+					case '{', '[':
+						depth++
+					case '}', ']':
+						depth--
+						done = depth == 0
+					}
+				}
+			}
+
+			if !oversized {
+				return raw, start, nil
+			}
+			if DeadLetter != nil && deadErr == nil {
+				deadErr = deadLetter(append(chunk, '\n'))
+			}
+			if deadErr != nil {
+				return nil, start, deadErr
+			}
+
+			Scanned++
+			Oversized++
+			fmt.Fprintf(os.Stderr, "Skipping %s at offset %d: %d bytes exceeds -max-record-bytes\n", recordName(index), start, size)
+		}
+	}
+}
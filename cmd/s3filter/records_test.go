@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOversizedRecordsWithWorkers(t *testing.T) {
+	big := `{"id":0,"words":["` + strings.Repeat("x", 3*deadLetterChunk) + `"]}` + "\n"
+	src := numbered(300) + big + numbered(300)
+	deadLetter := filepath.Join(t.TempDir(), "dead.ndjson")
+	defer func() { DeadLetter = nil }()
+
+	Oversized = 0
+	out := runFilter(t, src, "-workers", "4", "-max-record-bytes", "1000", "-dead-letter", deadLetter)
+	if got := strings.Count(out, "\n"); got != 600 {
+		t.Errorf("%d records, want 600", got)
+	}
+	if Oversized != 1 || Scanned != 601 {
+		t.Errorf("%d oversized of %d scanned, want 1 of 601", Oversized, Scanned)
+	}
+	if err := DeadLetter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != big {
+		t.Errorf("dead letter has %d bytes, want the %d of the oversized record", len(data), len(big))
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// CPU and memory limits of the container the process runs in, zero when unconstrained
+type resources struct {
+	CPUs   float64
+	Memory int64
+}
+
+var Resources resources
+
+// Read the cgroup v2 (or else v1) limits of the current container
+func detectResources() resources {
+	var r resources
+	if quota, period, ok := readCPUMax("/sys/fs/cgroup/cpu.max"); ok {
+		r.CPUs = quota / period
+	} else if quota, ok := readLimit("/sys/fs/cgroup/cpu/cpu.cfs_quota_us"); ok && quota > 0 {
+		if period, ok := readLimit("/sys/fs/cgroup/cpu/cpu.cfs_period_us"); ok && period > 0 {
+			r.CPUs = float64(quota) / float64(period)
+		}
+	}
+
+	if memory, ok := readLimit("/sys/fs/cgroup/memory.max"); ok {
+		r.Memory = memory
+	} else if memory, ok := readLimit("/sys/fs/cgroup/memory/memory.limit_in_bytes"); ok && memory < 1<<60 {
+		// v1 reports an unlimited group as a huge page-aligned number
+		r.Memory = memory
+	}
+	return r
+}
+
+// Parse `{quota|max} {period}` from cgroup v2 cpu.max
+func readCPUMax(path string) (float64, float64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, 0, false
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, 0, false
+	}
+	return quota, period, true
+}
+
+// Parse a single number from a cgroup file, `max` meaning no limit
+func readLimit(path string) (int64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// Fit the runtime to the container: GOMAXPROCS to the CPU quota and a soft heap limit just under the memory limit.
+// GOMAXPROCS and GOMEMLIMIT set in the environment take precedence.
+func applyResources() {
+	Resources = detectResources()
+	if Resources.CPUs > 0 && os.Getenv("GOMAXPROCS") == "" {
+		cpus := int(math.Ceil(Resources.CPUs))
+		if cpus < runtime.GOMAXPROCS(0) {
+			runtime.GOMAXPROCS(cpus)
+		}
+	}
+	if Resources.Memory > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(Resources.Memory / 10 * 9)
+	}
+}
+
+// Size download concurrency and part size to the container rather than the host:
+// the `-download-concurrency`, or else the `-mode` preset's ranged GETs per usable CPU (by default two, at most six),
+// within `-max-connections`, with parts in flight kept within a quarter of the memory limit
+func sizeDownloader(d *s3manager.Downloader) {
+	d.Concurrency, _ = downloadSizing()
+	if Resources.Memory > 0 {
+		part := Resources.Memory / 4 / int64(d.Concurrency)
+		if part < s3manager.MinUploadPartSize {
+			part = s3manager.MinUploadPartSize
+		}
+		if part < d.PartSize {
+			d.PartSize = part
+		}
+	}
+}
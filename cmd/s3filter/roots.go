@@ -0,0 +1,23 @@
+//go:build cabundle
+
+package main
+
+import (
+	"crypto/x509"
+	_ "embed"
+)
+
+// Mozilla CA roots copied in by `make static` (or the Dockerfile) and embedded in the binary,
+// so TLS to S3 works in a `FROM scratch` image with no /etc/ssl
+//
+//go:embed ca-certificates.crt
+var caBundle []byte
+
+// Fall back to the embedded roots only when the platform has none of its own
+func init() {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		panic("s3filter: embedded ca-certificates.crt holds no certificates")
+	}
+	x509.SetFallbackRoots(roots)
+}
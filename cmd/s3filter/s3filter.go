@@ -0,0 +1,1144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jmespath/go-jmespath"
+	"s3filter"
+)
+
+// NDJSON document, as decoded by the library
+type Record = s3filter.Record
+
+// Arguments variables
+var (
+	S3URI      *string
+	Inputs     []string
+	Limit      *int64
+	Recursive  *bool
+	WithIDs    []int64
+	IDSet      map[int64]bool
+	FromTime   time.Time
+	ToTime     time.Time
+	WithWords  []string
+	WordMatch  *string
+	Without    []string
+	WordRegex  *s3filter.PatternSet
+	Where      *s3filter.Where
+	Notify     *string
+	Access     *Policy
+	Tokens     Tokenizer
+	TokenIDs   []string
+	Casts      map[string]string
+	Renames    map[string]string
+	Contract   *Schema
+	OnInvalid  *string
+	DeadLetter *os.File
+	Checks     []*Check
+	Rate       *RateExpectation
+	Context    *contextWindow
+	Pick       *extreme
+	Exists     *bool
+	SortedBy   *string
+	KeyFilter  *KeyPattern
+	Encoding   *string
+	MaxRecord  *int64
+)
+
+// Destination of matching records
+var Output io.Writer = os.Stdout
+
+// Set by `-output`: where Output writes to, empty for stdout
+var OutputLocation string
+
+// Set by `-count` and `-count-totals`: print counts rather than records
+var (
+	Count       bool
+	CountTotals bool
+)
+
+// Run statistics
+var (
+	Scanned int64
+	Matched int64
+)
+
+// The object being filtered, named in the messages about its records
+var Object string
+
+// Digest of the flags deciding what a filtered copy contains, recorded on copies so `sync` redoes them when it changes
+var CriteriaDigest string
+
+/*
+s3filter filters NDJSON records of S3 objects to stdout.
+
+	s3filter -input s3://{bucket}/{key} [flags]
+	s3filter {get|decompress|put|copy|sync|athena|digest} [args]
+
+The flag and subcommand reference is generated from the flag definitions by `s3filter -help-format md` (or `text`, `json`).
+*/
+// Define the filter flags on flags, parse args and resolve the criteria.
+// Subcommands that filter records share these flags.
+func processArgs(flags *flag.FlagSet, args []string) {
+	var inputs stringList
+	helpFormat := flags.String("help-format", "", "Print the flag and subcommand reference as `md`, `text` or `json`, and exit.")
+	configJSON := flags.String("config-json", "", "A JSON file of flag values, as printed by `-print-effective-config`, to reproduce a run; flags on the command line take precedence.")
+	flags.StringVar(&History, "history", os.Getenv("S3FILTER_HISTORY"), "Where the run summary is kept for `s3filter history`: a local file, `s3://{bucket}/{prefix}/` or `off`; the user configuration directory by default, or `S3FILTER_HISTORY`.")
+	costReport := flags.Bool("cost-report", false, "Estimate the AWS cost of the run (requests, data transfer, S3 Select scanning, KMS calls) and add it to the run summary.")
+	costPrices := flags.String("cost-prices", "", "A JSON price file for `-cost-report`, e.g. `{\"transfer_per_gb\": 0}` when running in the bucket's region; us-east-1 list prices by default.")
+	printConfig := flags.Bool("print-effective-config", false, "Print the fully resolved flags (defaults included) and AWS environment as JSON on stderr before running.")
+	Recursive = flags.Bool("recursive", false, "Treat every `-input` as a prefix and filter all objects under it; inputs ending in `/` are always prefixes.")
+	flags.Var(&inputs, "input", "An S3 URI (`s3://{bucket}/{key}`) that refers to the source object to be filtered, where the bucket may be an access point or Object Lambda access point ARN, or an https:// URL, e.g. of a CloudFront distribution; repeatable or comma-separated, objects are filtered in order. Asked for, with bucket and key completion, when missing on a terminal.")
+	var withIDs stringList
+	flags.Var(&withIDs, "with-id", "An integer that contains the `id` of a JSON object to be selected; repeatable or comma-separated to select any of several.")
+	idFile := flags.String("with-id-file", "", "A file of ids to select, one per line, added to `-with-id`.")
+	var withWords stringList
+	flags.Var(&withWords, "with-word", "A string containing a word that must be contained in `words` of a JSON objec to be selected; repeatable, see `-word-match`.")
+	var without stringList
+	flags.Var(&without, "without-word", "A word whose presence in `words` drops a JSON object, e.g. `heartbeat`; repeatable.")
+	WordMatch = flags.String("word-match", "all", "Whether a record must contain `all` (default) or `any` of the `-with-word` words.")
+	query := flags.String("query", "", "A JMESPath `expression` evaluated on each record's document, e.g. user.country == 'DE' && contains(tags, 'new'); records for which it yields a true value (not false, null or empty) are selected.")
+	expr := flags.String("expr", "", "A boolean `expression` over each record's fields, e.g. id > 100 && time >= \"2024-01-01T00:00:00Z\" && (\"error\" in words); combined with the other filters, all of which must hold. Written in CEL (https://cel.dev) over the record's top-level fields; a record it fails to evaluate on, e.g. for lack of a field, is handled according to `-on-malformed`.")
+	var selectFields stringList
+	flags.Var(&selectFields, "select", "Emit only these fields of each matching record, e.g. `id,time` or `user.id`; repeatable or comma-separated, applied after `-rename`.")
+	var wordRegex stringList
+	flags.Var(&wordRegex, "with-word-regex", "A regular expression, e.g. `^err(or)?$`, that one of the `words` of a JSON object must match to be selected; repeatable, any of the patterns matching is enough.")
+	wordRegexFile := flags.String("with-word-regex-file", "", "A file of regular expressions, one per line, added to `-with-word-regex`; thousands of patterns are matched in one pass per word.")
+	Notify = flags.String("notify", "", "A webhook (`slack://{host}/{path}` or `teams://{host}/{path}`) that receives the run summary or failure details.")
+	policy := flags.String("policy", "", "A YAML policy file listing the `fields` and record `types` the caller may see and the `deny_words` whose records are dropped.")
+	tokenFields := flags.String("tokenize", "", "A comma-separated list of fields (e.g. `id,words`) whose values are replaced with tokens.")
+	tokenURL := flags.String("tokenize-url", "", "The URL of the tokenization service used by `-tokenize`.")
+	casts := flags.String("cast", "", "A comma-separated list of `field:type` output conversions (`string`, `int`, `float`, `unix`, `unixmilli`), e.g. `time:string,id:string`.")
+	mapping := flags.String("rename", "", "A JSON file mapping field names to the names used on output, e.g. `{\"id\": \"event_id\"}`.")
+	schema := flags.String("validate-schema", "", "A JSON Schema file that every record is validated against.")
+	OnInvalid = flags.String("on-invalid", "drop", "What to do with records that violate `-validate-schema`: `drop` (default), `tag` or `dead-letter`.")
+	Format = flags.String("format", "ndjson", "The source format: `ndjson` (default), or `csv` / `tsv` with a header row whose columns are mapped onto `id`, `time` and `words`.")
+	flags.StringVar(&Columns.id, "id-column", "id", "The `-format csv` column holding the record `id`.")
+	flags.StringVar(&Columns.time, "time-column", "time", "The `-format csv` column holding the record `time` (RFC 3339).")
+	flags.StringVar(&Columns.words, "words-column", "words", "The `-format csv` column holding the record `words`.")
+	flags.StringVar(&Columns.separator, "words-separator", " ", "The separator between the words of the `-words-column`; a space by default.")
+	OnMalformed = flags.String("on-malformed", "fail", "What to do with lines that are valid JSON but not an object, or repeat a key: `fail` (default), `skip` or `dead-letter`.")
+	deadLetter := flags.String("dead-letter", "", "A local file that receives invalid records when `-on-invalid=dead-letter` (or malformed lines when `-on-malformed=dead-letter`).")
+	var where stringList
+	flags.Var(&where, "where", "A condition on any field of the source document, `{field}={value}` or `{field}!={value}` with nested fields named by dots or by a JSON pointer, e.g. `user.country=DE` or `/user/tags/0=new` (repeatable, all must hold).")
+	var checks stringList
+	flags.Var(&checks, "check", "A data quality check evaluated over every record (repeatable): `{field} not null`, `{field} between {low} and {high}` or `unique {field}`; time bounds are written as for `-from-time` and `-to-time`, relative to `-now`.")
+	expectRate := flags.String("expect-rate", "", "The expected number of matching records per time bucket, e.g. `1000±20%/hour`; buckets outside the range are flagged.")
+	Encoding = flags.String("input-encoding", "auto", "The text encoding of the source object: `auto` (default, detects UTF-16 by its BOM), `utf-8`, `utf-16le` or `utf-16be`.")
+	MaxRecord = flags.Int64("max-record-bytes", 0, "The size limit of a single record; larger records are skipped (or dead-lettered) and their offset reported.")
+	progress := flags.Bool("progress", false, "Print download progress with throughput and ETA estimates to stderr.")
+	color := flags.String("color", "auto", "Syntax highlight output JSON and the matched word: `auto` (default, when stdout is a terminal), `always` or `never`.")
+	context := flags.Int("context", 0, "The number of records before and after each match that are also emitted, annotated with `\"_context\": true`.")
+	first := flags.Bool("first", false, "Emit only the earliest matching record; decoding stops at the first match with `-by=file`.")
+	last := flags.Bool("last", false, "Emit only the latest matching record.")
+	by := flags.String("by", "time", "The order used by `-first` and `-last`: `time` (default) or `file`.")
+	flags.StringVar(&ProfileDir, "profile-report", "", "Profile the run and write `cpu.pprof`, `heap.pprof` and a `summary.txt` of the top functions to this directory at exit.")
+	flags.BoolVar(&VerifyCount, "verify-count", false, "Fail an object whose number of records differs from the count its producer recorded in `x-amz-meta-record-count` or a `{key}.count` sidecar, catching truncated uploads.")
+	flags.BoolVar(&Count, "count", false, "Print only the number of matching records instead of the records.")
+	flags.BoolVar(&CountTotals, "count-totals", false, "With `-count`, print the number of records scanned after the number matched, separated by a tab.")
+	Exists = flags.Bool("exists", false, "Print nothing and exit as soon as a match is found with code 0, with code 1 when there is none, or with code 2 when an error kept any object from being searched.")
+	SortedBy = flags.String("assume-sorted-by", "", "Declare the source ordered by `time`, so decoding and the transfer stop once records pass `-to-time`; uncompressed NDJSON sources are binary searched for `-from-time`.")
+	keyPattern := flags.String("key-pattern", "", "The naming convention of source keys, e.g. `events_{shard}_{yyyyMMdd}.ndjson.gz`, used to skip objects outside the time window or selected shards; prefixes are only listed from the beginning it fixes on.")
+	var shards stringList
+	flags.Var(&shards, "shard", "A `{shard}` value of `-key-pattern` to process (repeatable); all shards by default.")
+	flags.DurationVar(&ObjectTimeout, "object-timeout", 0, "The longest time the transfer of a single object may take, e.g. `10m`.")
+	flags.DurationVar(&StallTimeout, "stall-timeout", 0, "Reconnect a download that received no bytes for this long, e.g. `30s`.")
+	KeepGoing = flags.Bool("keep-going", false, "In multi-object runs, report failed objects at the end (exit code 2) instead of aborting on the first error.")
+	statusOutput := flags.String("status-output", "", "In multi-object runs, write one NDJSON status record per object (key, status, matches, error, duration, output) to a local file, `-` (stdout) or `stderr`.")
+	flags.StringVar(&OutputStorageClass, "output-storage-class", "", "The storage class of written objects, e.g. `STANDARD_IA` or `GLACIER_IR`.")
+	flags.Var(&OutputTags, "output-tag", "A `key=value` tag added to written objects; repeatable.")
+	flags.StringVar(&OutputACL, "output-acl", "", "The canned ACL of written objects, e.g. `bucket-owner-full-control` (the default when the bucket keeps objects owned by their writer).")
+	flags.StringVar(&LockMode, "object-lock-mode", "", "Object Lock retention mode (`GOVERNANCE` or `COMPLIANCE`) set on written objects; needs `-object-lock-retain-until`.")
+	retainUntil := flags.String("object-lock-retain-until", "", "When the retention of written objects ends: an RFC3339 timestamp or a period from now, e.g. `2160h`.")
+	flags.BoolVar(&LegalHold, "legal-hold", false, "Place a legal hold on written objects.")
+	flags.Int64Var(&MaxDecompressed, "max-decompressed-bytes", 0, "Abort an object whose decompressed size exceeds this many bytes, guarding against decompression bombs.")
+	flags.BoolVar(&NoDecompress, "no-decompress", false, "Read objects as plain NDJSON without decompressing them, whatever their key extension (compression is otherwise detected from each object's first bytes).")
+	flags.Float64Var(&MaxExpansion, "max-expansion-ratio", 0, "Abort an object that expands more than this many times its compressed size, e.g. `100`.")
+	chained := flags.Bool("hash-chain", false, "Compute a SHA-256 hash chain over the emitted records and report its final digest in the run summary (verify with `s3filter digest`).")
+	Pushdown = flags.Bool("pushdown", false, "Push `-with-id` and `-with-word` down to S3 Select so only candidate records are transferred; the object must hold one record per line.")
+	flags.BoolVar(&EscapeHTML, "escape-html", true, "Escape `<`, `>` and `&` in JSON strings; `-escape-html=false` writes them as is.")
+	flags.IntVar(&FlushSize, "flush-size", 1<<20, "The number of bytes of matches buffered before they are written to the output; 0 writes each match as it is found, the default on a terminal and with `-mode interactive`.")
+	flags.StringVar(&Mode, "mode", "", "Tune buffering, flushing and download concurrency for `interactive` use, showing matches as soon as they are read, or `batch` runs, maximizing total throughput.")
+	flags.BoolVar(&ASCIIOnly, "ascii-only", false, "Escape every non-ASCII character in JSON strings as `\\uXXXX`.")
+	lineEnding := flags.String("line-ending", "lf", "The line ending written after each record: `lf` or `crlf`.")
+	Limit = flags.Int64("limit", 0, "Stop after this many matching records, abandoning the rest of the transfer.")
+	Workers = flags.Int("workers", 1, "The number of goroutines decoding and matching records in parallel, and inflating the members of multi-member gzip objects.")
+	PreserveOrder = flags.Bool("preserve-order", false, "With `-workers`, write matches in input order rather than as batches complete.")
+	flags.StringVar(&EndpointURL, "endpoint-url", EndpointURL, "The URL of an S3 compatible endpoint, e.g. `http://localhost:9000` for MinIO or LocalStack; `AWS_ENDPOINT_URL_S3` or `AWS_ENDPOINT_URL` by default.")
+	flags.BoolVar(&ForcePathStyle, "force-path-style", ForcePathStyle, "Address buckets in the URL path (`{endpoint}/{bucket}/{key}`) rather than as a subdomain, as most S3 compatible stores require; `AWS_S3_FORCE_PATH_STYLE` by default.")
+	flags.StringVar(&Profile, "profile", "", "The `name` of the profile of ~/.aws/config and ~/.aws/credentials to use, instead of AWS_PROFILE or the default profile.")
+	flags.StringVar(&Region, "region", "", "The AWS `region` of the requests, e.g. eu-west-1, instead of AWS_REGION or the profile's region.")
+	flags.StringVar(&RoleARN, "role-arn", "", "The ARN of a role to assume with STS, e.g. for buckets in another account; the base credentials must be allowed to assume it.")
+	flags.StringVar(&ExternalID, "external-id", "", "The external ID the `-role-arn` trust policy requires.")
+	flags.StringVar(&SessionName, "session-name", SessionName, "The session name of the assumed role, shown in CloudTrail.")
+	flags.DurationVar(&RoleDuration, "role-duration", 0, "How long the assumed role credentials last before they are renewed, e.g. `1h`; 15 minutes by default, at most the role's maximum session duration.")
+	flags.StringVar(&CloudFrontKeyID, "cloudfront-key-pair-id", "", "The ID of the CloudFront public key (or key pair) https:// inputs are signed for, with `-cloudfront-private-key`.")
+	cloudFrontKey := flags.String("cloudfront-private-key", "", "A PEM `file` holding the RSA private key signing requests to https:// inputs served by a CloudFront distribution that requires signed URLs or cookies.")
+	flags.StringVar(&CloudFrontSign, "cloudfront-sign", CloudFrontSign, "How requests to the distribution are signed: as a signed `url` (default) or with signed `cookie`s.")
+	flags.DurationVar(&CloudFrontExpiry, "cloudfront-expiry", CloudFrontExpiry, "How long each signature stays valid, e.g. `1h`.")
+	flags.IntVar(&DownloadConcurrency, "download-concurrency", 0, "The ranged GETs of an object in flight at once, each fetching a part of up to 8MiB ahead of the filter; sized by `-mode` and the usable CPUs when 0.")
+	flags.IntVar(&MaxConnections, "max-connections", 0, "The most connections open to S3 at once; transfers beyond it wait for a free connection.")
+	flags.IntVar(&MaxGoroutines, "max-goroutines", 0, "Fail the run, with guidance, when it runs more goroutines than this; a warning is printed when it nears it.")
+	flags.BoolVar(&UseFIPS, "use-fips", false, "Use FIPS 140-2 validated endpoints, e.g. for GovCloud (`aws-us-gov`) deployments.")
+	flags.BoolVar(&PrintIdentity, "print-identity", false, "Print the AWS identity and credential provider in use (via STS GetCallerIdentity) before running.")
+	output := flags.String("output", "", "Where matches are written instead of stdout: a local file, an S3 object (`s3://{bucket}/{key}`) uploaded in parts as matches are found, a Unix socket (`unix:///path/to.sock`) or a named pipe, reconnecting when the consumer restarts.")
+	flags.StringVar(&OutputCompression, "output-compression", "", "Compress the `-output` stream, and the objects `put`, `copy` and `sync` upload, with `gzip` or `zstd`, or `none`; by default `.gz` and `.zst` destinations are compressed.")
+	fromTime := flags.String("from-time", "", "An RFC3339 timestamp that represents the earliest `time` of a JSON object to be selected; also a date (`2024-06-01`) or a time relative to now (`-24h`, `now-7d`).")
+	toTime := flags.String("to-time", "", "An RFC3339 timestamp that represents the latest `time` of JSON object to be selected; also a date, covering the whole day, or a time relative to now.")
+	nowFlag := flags.String("now", "", "The RFC3339 time relative `-from-time` and `-to-time` are resolved against, instead of the clock, to reproduce a run.")
+	flags.Parse(args)
+	if *helpFormat != "" {
+		if err := printHelp(os.Stdout, flags, *helpFormat); err != nil {
+			exitErrorf("%v", err)
+		}
+		os.Exit(0)
+	}
+	if *configJSON != "" {
+		if err := applyConfig(flags, *configJSON); err != nil {
+			exitErrorf("Unable to apply -config-json %v", err)
+		}
+	}
+
+	var err error
+	now := time.Now()
+	if *nowFlag != "" {
+		if now, err = time.Parse(time.RFC3339, *nowFlag); err != nil {
+			exitErrorf("Unable to parse -now %v", err)
+		}
+	}
+	FromTime, ToTime = time.Time{}, time.Time{}
+	if *fromTime != "" {
+		if FromTime, err = parseTimeExpr(*fromTime, now, false); err != nil {
+			exitErrorf("Unable to parse -from-time %v", err)
+		}
+	}
+	if *toTime != "" {
+		if ToTime, err = parseTimeExpr(*toTime, now, true); err != nil {
+			exitErrorf("Unable to parse -to-time %v", err)
+		}
+	}
+
+	if *printConfig {
+		if err := printEffectiveConfig(flags, now); err != nil {
+			exitErrorf("Unable to print the effective configuration %v", err)
+		}
+	}
+	CriteriaDigest = criteriaDigest(flags)
+	beginRun(flags)
+
+	for _, input := range inputs {
+		for _, uri := range strings.Split(input, ",") {
+			if uri = strings.TrimSpace(uri); uri != "" {
+				Inputs = append(Inputs, uri)
+			}
+		}
+	}
+	label := strings.Join(Inputs, ",")
+	S3URI = &label
+
+	if *policy != "" {
+		Access, err = loadPolicy(*policy)
+		if err != nil {
+			exitErrorf("Unable to load policy %v", err)
+		}
+	}
+
+	if *tokenFields != "" {
+		if *tokenURL == "" {
+			exitErrorf("`-tokenize` requires `-tokenize-url`")
+		}
+		TokenIDs = strings.Split(*tokenFields, ",")
+		Tokens = newHTTPTokenizer(*tokenURL)
+	}
+
+	if *casts != "" {
+		Casts, err = parseCasts(*casts)
+		if err != nil {
+			exitErrorf("Unable to parse casts %v", err)
+		}
+	}
+
+	if *mapping != "" {
+		Renames, err = loadMapping(*mapping)
+		if err != nil {
+			exitErrorf("Unable to load mapping %v", err)
+		}
+	}
+
+	if *schema != "" {
+		Contract, err = loadSchema(*schema)
+		if err != nil {
+			exitErrorf("Unable to load schema %v", err)
+		}
+	}
+
+	switch *Format {
+	case "ndjson", "csv", "tsv":
+	default:
+		exitErrorf("Unknown `-format` %q, expected `ndjson`, `csv` or `tsv`", *Format)
+	}
+	if *MaxRecord > 0 && *Format != "ndjson" {
+		exitErrorf("`-max-record-bytes` bounds JSON values, so it can't be combined with `-format %s`", *Format)
+	}
+
+	switch *OnMalformed {
+	case "fail", "skip":
+	case "dead-letter":
+		if *deadLetter == "" {
+			exitErrorf("`-on-malformed=dead-letter` requires `-dead-letter`")
+		}
+	default:
+		exitErrorf("Unknown `-on-malformed` action %q", *OnMalformed)
+	}
+
+	switch *OnInvalid {
+	case "drop", "tag":
+	case "dead-letter":
+		if *deadLetter == "" {
+			exitErrorf("`-on-invalid=dead-letter` requires `-dead-letter`")
+		}
+	default:
+		exitErrorf("Unknown `-on-invalid` action %q", *OnInvalid)
+	}
+
+	if *deadLetter != "" {
+		DeadLetter, err = os.Create(*deadLetter)
+		if err != nil {
+			exitErrorf("Unable to create dead letter file %v", err)
+		}
+	}
+
+	if WithIDs, err = parseIDs(withIDs, *idFile); err != nil {
+		exitErrorf("Invalid -with-id %v", err)
+	}
+	if len(WithIDs) > 0 {
+		IDSet = make(map[int64]bool, len(WithIDs))
+		for _, id := range WithIDs {
+			IDSet[id] = true
+		}
+	}
+	WithWords = withWords
+	Without = without
+	switch *WordMatch {
+	case "all", "any":
+	default:
+		exitErrorf("Unknown `-word-match` %q, expected `all` or `any`", *WordMatch)
+	}
+
+	if *query != "" {
+		if Query, err = jmespath.Compile(*query); err != nil {
+			exitErrorf("Invalid -query %v", err)
+		}
+	}
+	if *expr != "" {
+		if Expr, err = compileExpr(*expr); err != nil {
+			exitErrorf("Invalid -expr %v", err)
+		}
+	}
+
+	if len(selectFields) > 0 {
+		if Selected, err = parseSelect(selectFields); err != nil {
+			exitErrorf("Invalid -select %v", err)
+		}
+	}
+
+	if len(wordRegex) > 0 || *wordRegexFile != "" {
+		patterns, err := readPatterns(wordRegex, *wordRegexFile)
+		if err != nil {
+			exitErrorf("Unable to read -with-word-regex-file %v", err)
+		}
+		if WordRegex, err = s3filter.CompilePatterns(patterns); err != nil {
+			exitErrorf("Invalid -with-word-regex %v", err)
+		}
+	}
+
+	if *costReport || *costPrices != "" {
+		Usage = &usage{}
+		if *costPrices != "" {
+			if CostTable, err = loadPrices(*costPrices); err != nil {
+				exitErrorf("Unable to load -cost-prices %v", err)
+			}
+		}
+	}
+
+	Where = nil
+	if len(where) > 0 {
+		conditions := make([]s3filter.Condition, len(where))
+		for i, expr := range where {
+			if conditions[i], err = s3filter.ParseCondition(expr); err != nil {
+				exitErrorf("Invalid -where %v", err)
+			}
+		}
+		Where = s3filter.NewWhere(conditions...)
+	}
+
+	Checks = nil
+	for _, expr := range checks {
+		check, err := parseCheck(expr, now)
+		if err != nil {
+			exitErrorf("Invalid check %v", err)
+		}
+		Checks = append(Checks, check)
+	}
+
+	if *expectRate != "" {
+		Rate, err = parseRate(*expectRate)
+		if err != nil {
+			exitErrorf("Invalid expected rate %v", err)
+		}
+	}
+
+	if *progress {
+		Tracker = newProgress()
+	}
+
+	Colorize = useColor(*color)
+
+	Context = nil
+	if *context > 0 {
+		Context = &contextWindow{size: *context}
+	}
+
+	KeyFilter = nil
+	if *keyPattern != "" {
+		KeyFilter, err = parseKeyPattern(*keyPattern, shards)
+		if err != nil {
+			exitErrorf("%v", err)
+		}
+	}
+
+	if err = checkOutputSettings(); err != nil {
+		exitErrorf("%v", err)
+	}
+	if *retainUntil != "" {
+		if RetainUntil, err = parseRetainUntil(*retainUntil); err != nil {
+			exitErrorf("Unable to parse -object-lock-retain-until %v", err)
+		}
+	}
+	switch {
+	case LockMode != "" && LockMode != "GOVERNANCE" && LockMode != "COMPLIANCE":
+		exitErrorf("Unknown -object-lock-mode %q, expected `GOVERNANCE` or `COMPLIANCE`", LockMode)
+	case (LockMode != "") != (*retainUntil != ""):
+		exitErrorf("-object-lock-mode and -object-lock-retain-until must be used together")
+	}
+
+	if LineEnding, err = parseLineEnding(*lineEnding); err != nil {
+		exitErrorf("%v", err)
+	}
+
+	if *chained {
+		Chain = &hashChain{}
+	}
+
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if err = applyMode(explicit); err != nil {
+		exitErrorf("%v", err)
+	}
+
+	OutputLocation = *output
+	if *output != "" {
+		compression, err := outputCompression(*output)
+		if err != nil {
+			exitErrorf("%v", err)
+		}
+		writer, err := openOutput(*output, compression)
+		if err != nil {
+			exitErrorf("Unable to open output %v", err)
+		}
+		Output, OutputCloser = writer, writer
+	}
+
+	if *statusOutput != "" {
+		if err = openStatusLog(*statusOutput); err != nil {
+			exitErrorf("Unable to open status output %v", err)
+		}
+	}
+
+	if *SortedBy != "" && *SortedBy != "time" {
+		exitErrorf("Unsupported sort key %q for `-assume-sorted-by`", *SortedBy)
+	}
+
+	if CountTotals {
+		Count = true
+	}
+	if VerifyCount && (*Limit > 0 || *Exists || *first || *last || *SortedBy != "" || *Pushdown) {
+		exitErrorf("`-verify-count` reads every record, so it can't be combined with `-limit`, `-exists`, `-first`, `-last`, `-assume-sorted-by` or `-pushdown`")
+	}
+	if Count && (*context > 0 || *first || *last || *Exists) {
+		exitErrorf("`-count` can't be combined with `-context`, `-first`, `-last` or `-exists`")
+	}
+
+	if *first || *last {
+		if *first && *last {
+			exitErrorf("`-first` and `-last` are mutually exclusive")
+		}
+		if Context != nil {
+			exitErrorf("`-context` can't be combined with `-first` or `-last`")
+		}
+		if *by != "time" && *by != "file" {
+			exitErrorf("Unknown order %q for `-by`", *by)
+		}
+		Pick = &extreme{last: *last, byTime: *by == "time", sorted: *SortedBy == "time"}
+	}
+
+	if (ExternalID != "" || RoleDuration > 0) && RoleARN == "" {
+		exitErrorf("-external-id and -role-duration require -role-arn")
+	}
+
+	if *cloudFrontKey != "" {
+		if CloudFrontKeyID == "" {
+			exitErrorf("-cloudfront-private-key requires -cloudfront-key-pair-id")
+		}
+		if CloudFrontKey, err = sign.LoadPEMPrivKeyFile(*cloudFrontKey); err != nil {
+			exitErrorf("Invalid -cloudfront-private-key %v", err)
+		}
+	} else if CloudFrontKeyID != "" {
+		exitErrorf("-cloudfront-key-pair-id requires -cloudfront-private-key")
+	}
+	switch CloudFrontSign {
+	case "url", "cookie":
+	default:
+		exitErrorf("Unknown `-cloudfront-sign` %q, expected `url` or `cookie`", CloudFrontSign)
+	}
+
+	monitorGoroutines()
+
+	if ProfileDir != "" {
+		if err = startProfile(); err != nil {
+			exitErrorf("Unable to start profiling %v", err)
+		}
+	}
+}
+
+// Build the JSON document emitted for a record with the encoder e.
+// A record no option rewrites is emitted as read, compacted; annotations such as schema `_violations` are added to the document.
+func render(e *encoder, record Record, annotations map[string]interface{}) ([]byte, error) {
+	if !rewrites(annotations) {
+		if record.Raw == nil {
+			return e.encode(record)
+		}
+		return e.compact(record.Raw)
+	}
+
+	doc := document(record)
+	for name, value := range annotations {
+		doc[name] = value
+	}
+	if Access != nil {
+		Access.strip(doc)
+	}
+	if Tokens != nil {
+		if err := tokenize(doc, TokenIDs, Tokens); err != nil {
+			return nil, err
+		}
+	}
+	if Casts != nil {
+		if err := cast(doc, Casts); err != nil {
+			return nil, err
+		}
+	}
+	if Renames != nil {
+		rename(doc, Renames)
+	}
+	if Selected != nil {
+		doc = project(doc, Selected)
+		for name, value := range annotations {
+			doc[name] = value
+		}
+	}
+	return e.encode(doc)
+}
+
+// Report whether an option or annotations change the document emitted for a record
+func rewrites(annotations map[string]interface{}) bool {
+	return Access != nil || Tokens != nil || Casts != nil || Renames != nil || Selected != nil || len(annotations) > 0
+}
+
+// The output document of a record: every field of the source document,
+// with `id`, `time` and `words` in their decoded types where the source had them in the expected type
+func document(record Record) map[string]interface{} {
+	doc := map[string]interface{}{}
+	if record.Raw == nil || s3filter.DecodeValue(record.Raw, &doc) != nil {
+		return map[string]interface{}{"id": record.Id, "time": record.Time, "words": record.Words}
+	}
+	if _, ok := doc["id"].(json.Number); ok && record.Id != 0 {
+		doc["id"] = record.Id
+	}
+	if _, ok := doc["time"].(string); ok && !record.Time.IsZero() {
+		doc["time"] = record.Time
+	}
+	if _, ok := doc["words"].([]interface{}); ok && record.Words != nil {
+		doc["words"] = record.Words
+	}
+	return doc
+}
+
+// Annotate err with the 1-based index and byte offset of the record it relates to
+func recordError(index int64, offset int64, err error) error {
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		offset = syntaxErr.Offset
+	}
+	return fmt.Errorf("record %d at offset %d: %v", index, offset, err)
+}
+
+// parse bytes array to ndJson and filter based on criteria, writing out the matches before returning
+func filter(src io.Reader) error {
+	err := filterRecords(src)
+	if flushErr := flushOutput(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// Records are read as s3filter.Records reads them, unless they are CSV or bounded by `-max-record-bytes`,
+// and go through the same steps as in s3filter.Filter, with the run's bookkeeping in between.
+func filterRecords(src io.Reader) error {
+	var next func() (json.RawMessage, int64, error)
+	switch {
+	case *Format == "csv":
+		next = delimitedRecords(src, ',')
+	case *Format == "tsv":
+		next = delimitedRecords(src, '\t')
+	case *MaxRecord > 0:
+		next = boundedRecords(src, *MaxRecord)
+	default:
+		next = s3filter.Records(src)
+	}
+	if decodesInParallel() {
+		return filterParallel(next)
+	}
+
+	// records are numbered within the source, as their offsets are
+	first := Scanned
+	// the criteria don't change within a source, so they are only built once
+	selection := criteria()
+	for {
+		// Decode one JSON document.
+		raw, offset, err := next()
+
+		if err != nil {
+			// io.EOF is expected at end of stream.
+			if err != io.EOF {
+				return recordError(Scanned-first+1, offset, err)
+			}
+			break
+		}
+		Scanned++
+
+		if err = s3filter.CheckObject(raw); err != nil {
+			if err = malformed(Scanned-first, offset, raw, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(Checks) > 0 {
+			if err = runChecks(Checks, raw); err != nil {
+				return recordError(Scanned-first, offset, err)
+			}
+		}
+
+		// Validate against the contract before typed decoding
+		var violations []string
+		if Contract != nil {
+			violations, err = Contract.check(raw)
+			if err != nil {
+				return recordError(Scanned-first, offset, err)
+			}
+			if len(violations) > 0 {
+				switch *OnInvalid {
+				case "drop":
+					continue
+				case "dead-letter":
+					if err = deadLetter(append(raw, '\n')); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+		}
+
+		record, err := s3filter.Decode(raw)
+		if err != nil {
+			if len(violations) > 0 {
+				// tagged records that don't fit Record are dropped, and reported with the violations
+				UntaggedInvalid++
+				continue
+			}
+			return recordError(Scanned-first, offset, err)
+		}
+
+		matched := selection.Matches(record)
+		if matched {
+			if matched, err = refines(record); err != nil {
+				if err = malformed(Scanned-first, offset, raw, err); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		stop, err := handle(record, violations, matched)
+		if err != nil {
+			return err
+		}
+		if stop {
+			break
+		}
+	}
+	return nil
+}
+
+// Write out the record selected by `-first` or `-last` among everything filtered since the last call
+func flushPick() error {
+	if Pick == nil || *Exists {
+		return nil
+	}
+	err := Pick.flush()
+	if flushErr := flushOutput(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// Apply the access policy and outputs to one decoded record that did (or did not) match the criteria.
+// stop reports that nothing more needs to be read.
+func handle(record Record, violations []string, matched bool) (stop bool, err error) {
+	// an earlier object of the run already found them all
+	if limitReached() {
+		return true, nil
+	}
+	if err := ceilingError(); err != nil {
+		return false, err
+	}
+
+	// Nothing after this record can match in a time-ordered source
+	if *SortedBy == "time" && !ToTime.IsZero() && record.Time.After(ToTime) {
+		return true, nil
+	}
+
+	// Filter
+	if !matched {
+		// records the caller may not see aren't context either
+		if Context != nil && (Access == nil || Access.permits(record)) {
+			return false, Context.skip(record)
+		}
+		return false, nil
+	}
+	if Access != nil && !Access.permits(record) {
+		PolicyDropped++
+		return false, nil
+	}
+
+	Matched++
+	if *Exists {
+		return true, nil
+	}
+	if Rate != nil {
+		Rate.add(record.Time)
+	}
+	if Count {
+		return limitReached(), nil
+	}
+
+	if Context != nil {
+		if err = Context.match(); err != nil {
+			return false, err
+		}
+	}
+
+	var annotations map[string]interface{}
+	if len(violations) > 0 {
+		annotations = map[string]interface{}{"_violations": violations}
+	}
+	if Pick != nil {
+		return Pick.offer(record, annotations), nil
+	}
+	return limitReached(), emit(record, annotations)
+}
+
+// Report whether `-limit` matches have been found
+func limitReached() bool {
+	return *Limit > 0 && Matched >= *Limit
+}
+
+// Report whether decoding may stop before the end of the source,
+// in which case the object is streamed so the rest of the transfer can be abandoned
+func stopsEarly() bool {
+	if *Exists || *Limit > 0 {
+		return true
+	}
+	if *SortedBy == "time" && !ToTime.IsZero() {
+		return true
+	}
+	return Pick != nil && !Pick.last && (!Pick.byTime || Pick.sorted)
+}
+
+// Report whether a record satisfying the criteria also satisfies `-where`, `-query` and `-expr`,
+// which the sequential loop and the workers both apply after the criteria.
+// A record `-expr` fails to evaluate on is returned as an error, to be handled as malformed.
+func refines(record Record) (bool, error) {
+	if !Where.Matches(record.Raw) || !queryMatches(record) {
+		return false, nil
+	}
+	return exprMatches(record)
+}
+
+// The selection criteria of the flags, short of `-where`
+func criteria() s3filter.Criteria {
+	criteria := s3filter.Criteria{IDs: IDSet, From: FromTime, To: ToTime, Words: WithWords, AnyWord: *WordMatch == "any", WithoutWords: Without}
+	// a nil *PatternSet would make a non-nil Matcher
+	if WordRegex != nil {
+		criteria.WordPattern = WordRegex
+	}
+	return criteria
+}
+
+// Print a record as a json string
+func emit(record Record, annotations map[string]interface{}) error {
+	colorize := Colorize && Output == os.Stdout
+	if record.Raw != nil && Chain == nil && !colorize && !rewrites(annotations) {
+		return writeRaw(record.Raw)
+	}
+	e := encoders.Get().(*encoder)
+	defer encoders.Put(e)
+	s, err := render(e, record, annotations)
+	if err != nil {
+		return err
+	}
+	if Chain != nil {
+		Chain.add(s)
+	}
+	if colorize {
+		words := append([]string{}, WithWords...)
+		if WordRegex != nil {
+			for _, word := range record.Words {
+				if WordRegex.MatchString(word) {
+					words = append(words, word)
+				}
+			}
+		}
+		s = highlight(s, words)
+	}
+	return writeLine(s)
+}
+
+// Exit code of a failed run, as grep's, distinct from the 1 of `-exists` finding no match
+const exitFailure = 2
+
+// Print error messages and exit application
+func exitErrorf(msg string, args ...interface{}) {
+	flushOutput()
+	abortOutput(fmt.Sprintf(msg, args...))
+	fmt.Fprintf(os.Stderr, msg+"\n", args...)
+	source := ""
+	if S3URI != nil {
+		source = *S3URI
+	}
+	notify(fmt.Sprintf("s3filter failed for %s: "+msg, append([]interface{}{source}, args...)...))
+	finishProfile()
+	recordRun("failed", fmt.Sprintf(msg, args...))
+	os.Exit(exitFailure)
+}
+
+func main() {
+	applyResources()
+
+	//dispatch subcommands
+	if len(os.Args) > 1 {
+		for _, command := range subcommands {
+			if os.Args[1] == command.name {
+				command.run(os.Args[2:])
+				return
+			}
+		}
+	}
+
+	//parse arguments
+	flag.CommandLine.Usage = func() {
+		printHelp(os.Stderr, flag.CommandLine, "text")
+	}
+	processArgs(flag.CommandLine, os.Args[1:])
+	if statusToStdout && OutputLocation == "" {
+		exitErrorf("`-status-output -` can't share stdout with the records, use `-output` or a status file")
+	}
+
+	//`-input` flag is missing then print usage message, unless it can be asked for
+	interactive := isTerminal(os.Stdin) && isTerminal(os.Stderr)
+	if len(Inputs) == 0 && !interactive {
+		printHelp(os.Stdout, flag.CommandLine, "md")
+		os.Exit(exitFailure)
+	}
+	start := time.Now()
+
+	// Create Session
+	sess, err := newSession()
+	if err != nil {
+		exitErrorf("Failed to create new session. %v\n", err)
+		return
+	}
+
+	if len(Inputs) == 0 {
+		input, err := promptInput(s3.New(sess), os.Stdin, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			os.Exit(exitFailure)
+		}
+		Inputs = []string{input}
+		S3URI = &input
+		start = time.Now()
+	}
+
+	//expand prefixes into the objects under them
+	objects, err := expandInputs(s3.New(sess), Inputs)
+	if err != nil {
+		exitErrorf("Unable to list objects %v", err)
+	}
+
+	//filter each object in turn, concatenating the matches
+	for _, uri := range objects {
+		started, matched := time.Now(), Matched
+		Object = uri
+		if err = filterObject(sess, uri); err != nil {
+			if statusErr := writeStatus(uri, "failed", Matched-matched, err, started, OutputLocation); statusErr != nil {
+				exitErrorf("%v", statusErr)
+			}
+			if len(objects) == 1 {
+				exitErrorf("%v", err)
+			}
+			objectFailed(uri, err)
+			continue
+		}
+		if err = writeStatus(uri, "filtered", Matched-matched, nil, started, OutputLocation); err != nil {
+			exitErrorf("%v", err)
+		}
+
+		if *Exists && Matched > 0 || limitReached() || Pick != nil && Pick.settled() {
+			break
+		}
+		if err = ceilingError(); err != nil {
+			exitErrorf("%v", err)
+		}
+	}
+
+	//the -first or -last record of all the objects
+	if err = flushPick(); err != nil {
+		exitErrorf("Unable to write output %v", err)
+	}
+
+	//stop here, abandoning the rest of the transfer
+	if *Exists {
+		finishProfile()
+		switch {
+		case Matched > 0:
+			recordRun("succeeded", "")
+			os.Exit(0)
+		case len(Failures) > 0:
+			//the match may be in an object that failed
+			recordRun("partial", "")
+			os.Exit(exitPartialFailure)
+		}
+		recordRun("succeeded", "")
+		os.Exit(1)
+	}
+
+	if Count {
+		printCount()
+	}
+	report(start)
+}
+
+// Print the `-count` of matched (and scanned) records to the output
+func printCount() {
+	line := fmt.Sprint(Matched)
+	if CountTotals {
+		line += fmt.Sprintf("\t%d", Scanned)
+	}
+	if err := writeLine([]byte(line)); err != nil {
+		exitErrorf("Unable to write output %v", err)
+	}
+	if err := flushOutput(); err != nil {
+		exitErrorf("Unable to write output %v", err)
+	}
+}
+
+// Stream one object, decompress and decode it, and filter its records to the output
+func filterObject(sess *session.Session, uri string) error {
+	//read URLs, e.g. of a CloudFront distribution, over HTTP
+	if isURL(uri) {
+		return filterURL(uri)
+	}
+
+	//parse s3URI for Bucket and Key
+	s3_bucket, s3_key, err := s3filter.ParseURI(uri)
+	if err != nil {
+		return err
+	}
+
+	//download file from AWS S3 in parallel parts, or as a single stream when decoding may stop early;
+	//Object Lambda access points support neither S3 Select nor ranged reads
+	lambda := s3filter.IsObjectLambda(s3_bucket)
+	var selected io.ReadCloser
+	if !lambda && canPushdown() && selectExpression() != "" {
+		if selected, err = openSelected(sess, s3_bucket, s3_key); err != nil {
+			return fmt.Errorf("unable to select from file: %w", err)
+		}
+	}
+	var body io.Reader
+	switch {
+	case selected != nil:
+		//S3 Select returns only the records that can match, uncompressed
+		defer selected.Close()
+		body = selected
+	case !lambda && *SortedBy == "time" && !FromTime.IsZero() && !compressed(s3_key) && *Format == "ndjson":
+		//uncompressed time-ordered NDJSON: binary search the start of the window
+		offset, err := seekTime(sess, s3_bucket, s3_key, FromTime)
+		if err != nil {
+			return fmt.Errorf("unable to seek file: %w", err)
+		}
+		stream, err := openObject(sess, s3_bucket, s3_key, offset)
+		if err != nil {
+			return fmt.Errorf("unable to download file: %w", err)
+		}
+		defer stream.Close()
+		body = stream
+	case stopsEarly() || Preset.stream:
+		stream, err := openObject(sess, s3_bucket, s3_key, 0)
+		if err != nil {
+			return fmt.Errorf("unable to download file: %w", err)
+		}
+		defer stream.Close()
+		reader, err := decompress(stream, s3_key)
+		if err != nil {
+			return fmt.Errorf("unable to unzip file: %w", err)
+		}
+		body = reader
+	default:
+		//fetch parts with parallel ranged GETs, filtering each as soon as the ones before it are done
+		stream, err := transfer().Open(context.Background(), sess, s3_bucket, s3_key)
+		if err != nil {
+			return fmt.Errorf("unable to download file: %w", err)
+		}
+		defer stream.Close()
+		//Extract *.gz or *.zst
+		reader, err := decompressStream(stream, s3_key)
+		if err != nil {
+			return fmt.Errorf("unable to unzip file: %w", err)
+		}
+		//stops inflating members when decoding ends early
+		defer reader.Close()
+		body = reader
+	}
+
+	//Strip BOM and transcode UTF-16
+	text, err := s3filter.DecodeText(body, *Encoding)
+	if err != nil {
+		return fmt.Errorf("unable to decode text: %w", err)
+	}
+
+	//Decode ndjson from bytes and print record that matches with criteria
+	scanned := Scanned
+	err = filter(text)
+	if err != nil {
+		return fmt.Errorf("unable to decode ndjson file: %w", err)
+	}
+	if VerifyCount {
+		return verifyCount(sess, s3_bucket, s3_key, Scanned-scanned)
+	}
+	return nil
+}
+
+// Stream one object from a URL, decompress and decode it, and filter its records to the output
+func filterURL(uri string) error {
+	stream, err := openURL(uri)
+	if err != nil {
+		return fmt.Errorf("unable to download file: %w", err)
+	}
+	defer stream.Close()
+	body, err := decompress(stream, urlName(uri))
+	if err != nil {
+		return fmt.Errorf("unable to unzip file: %w", err)
+	}
+	text, err := s3filter.DecodeText(body, *Encoding)
+	if err != nil {
+		return fmt.Errorf("unable to decode text: %w", err)
+	}
+	if err = filter(text); err != nil {
+		return fmt.Errorf("unable to decode ndjson file: %w", err)
+	}
+	return nil
+}
+
+// Print the end of run reports and send the run summary
+func report(start time.Time) {
+	if Tracker != nil {
+		Tracker.close()
+	}
+	if OutputCloser != nil {
+		closer := OutputCloser
+		OutputCloser = nil
+		if err := closer.Close(); err != nil {
+			exitErrorf("Unable to write output %v", err)
+		}
+	}
+
+	if Contract != nil {
+		reportViolations()
+	}
+	if DeadLetter != nil {
+		if err := DeadLetter.Close(); err != nil {
+			exitErrorf("Unable to write to -dead-letter file %v", err)
+		}
+	}
+
+	if Malformed > 0 {
+		fmt.Fprintf(os.Stderr, "Malformed lines: %d skipped\n", Malformed)
+	}
+	if Access != nil {
+		fmt.Fprintf(os.Stderr, "Policy audit: %d records dropped, %d fields stripped\n", PolicyDropped, PolicyStripped)
+	}
+
+	if len(Checks) > 0 && !reportChecks(Checks) {
+		exitErrorf("Data quality checks failed")
+	}
+
+	summary := fmt.Sprintf("s3filter finished for %s: %d of %d records matched in %v", *S3URI, Matched, Scanned, time.Since(start).Round(time.Millisecond))
+	if Chain != nil {
+		fmt.Fprintf(os.Stderr, "Hash chain: %d records, %s\n", Chain.records, Chain.digest())
+		summary += fmt.Sprintf("\nHash chain digest of %d records: %s", Chain.records, Chain.digest())
+	}
+	if Usage != nil {
+		fmt.Fprintln(os.Stderr, Usage)
+		summary += "\n" + Usage.String()
+	}
+	if len(Failures) > 0 {
+		reportFailures()
+		summary += fmt.Sprintf("\n%d objects failed:\n%s", len(Failures), strings.Join(Failures, "\n"))
+	}
+	if len(Incidents) > 0 {
+		summary += fmt.Sprintf("\nTransfer incidents:\n%s", strings.Join(Incidents, "\n"))
+	}
+	if Rate != nil {
+		if anomalies := reportRate(Rate); len(anomalies) > 0 {
+			summary += fmt.Sprintf("\nRecord volume anomalies:\n%s", strings.Join(anomalies, "\n"))
+		}
+	}
+	notify(summary)
+	finishProfile()
+
+	if len(Failures) > 0 {
+		recordRun("partial", "")
+		os.Exit(exitPartialFailure)
+	}
+	recordRun("succeeded", "")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse `-cast` specifications such as `time:string,id:string`
+func parseCasts(spec string) (map[string]string, error) {
+	casts := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		field, kind, ok := strings.Cut(item, ":")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid cast %q, expected field:type", item)
+		}
+		switch kind {
+		case "string", "int", "float", "unix", "unixmilli":
+		default:
+			return nil, fmt.Errorf("unsupported cast type %q for field %s", kind, field)
+		}
+		casts[field] = kind
+	}
+	return casts, nil
+}
+
+// Read a JSON object mapping source field names to output field names.
+// Two fields renamed to the same name are rejected, as only one of them could be kept.
+func loadMapping(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping map[string]string
+	if err = json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("invalid mapping %s: %v", path, err)
+	}
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	sources := make(map[string]string, len(mapping))
+	for _, field := range fields {
+		target := mapping[field]
+		if other, ok := sources[target]; ok {
+			return nil, fmt.Errorf("invalid mapping %s: %s and %s are both renamed to %s", path, other, field, target)
+		}
+		sources[target] = field
+	}
+	return mapping, nil
+}
+
+// Convert the fields of doc to the requested output types
+func cast(doc map[string]interface{}, casts map[string]string) error {
+	for field, kind := range casts {
+		value, ok := doc[field]
+		if !ok {
+			continue
+		}
+
+		converted, err := castValue(value, kind)
+		if err != nil {
+			return fmt.Errorf("unable to cast field %s to %s: %v", field, kind, err)
+		}
+		doc[field] = converted
+	}
+	return nil
+}
+
+func castValue(value interface{}, kind string) (interface{}, error) {
+	switch v := value.(type) {
+	case time.Time:
+		switch kind {
+		case "string":
+			return v.Format(time.RFC3339Nano), nil
+		case "unix", "int":
+			return v.Unix(), nil
+		case "unixmilli":
+			return v.UnixMilli(), nil
+		case "float":
+			return float64(v.UnixNano()) / float64(time.Second), nil
+		}
+	case json.Number:
+		switch kind {
+		case "string":
+			return string(v), nil
+		case "int", "unix", "unixmilli":
+			return v.Int64()
+		case "float":
+			return v.Float64()
+		}
+	case int64:
+		switch kind {
+		case "string":
+			return strconv.FormatInt(v, 10), nil
+		case "int", "unix", "unixmilli":
+			return v, nil
+		case "float":
+			return float64(v), nil
+		}
+	case []string:
+		if kind == "string" {
+			return strings.Join(v, ","), nil
+		}
+	case string:
+		switch kind {
+		case "string":
+			return v, nil
+		case "int", "unix", "unixmilli":
+			return strconv.ParseInt(v, 10, 64)
+		case "float":
+			return strconv.ParseFloat(v, 64)
+		}
+	}
+	return nil, fmt.Errorf("unsupported source type %T", value)
+}
+
+// Rename the fields of doc according to mapping. A renamed field replaces a field already named like its target.
+func rename(doc map[string]interface{}, mapping map[string]string) {
+	renamed := make(map[string]interface{}, len(doc))
+	for field, value := range doc {
+		if _, ok := mapping[field]; !ok {
+			renamed[field] = value
+		}
+	}
+	for field, value := range doc {
+		if target, ok := mapping[field]; ok {
+			renamed[target] = value
+		}
+	}
+
+	for field := range doc {
+		delete(doc, field)
+	}
+	for field, value := range renamed {
+		doc[field] = value
+	}
+}
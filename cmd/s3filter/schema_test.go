@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMappingRejectsCollidingTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(path, []byte(`{"id": "key", "user": "key", "time": "at"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadMapping(path)
+	if err == nil || !strings.Contains(err.Error(), "id and user are both renamed to key") {
+		t.Fatalf("got %v, want a collision on key", err)
+	}
+}
+
+func TestRenamedFieldReplacesTarget(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		doc := map[string]interface{}{"id": 1, "key": 2, "a": 3, "b": 4}
+		rename(doc, map[string]string{"id": "key", "a": "b", "b": "a"})
+		if doc["key"] != 1 || doc["b"] != 3 || doc["a"] != 4 || len(doc) != 3 {
+			t.Fatalf("got %v", doc)
+		}
+	}
+}
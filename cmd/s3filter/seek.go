@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Size of the ranged GETs probing the object during the search
+const seekProbe = 64 * 1024
+
+// Locate the offset of a line at or before the first record whose time is not before from,
+// by binary searching an uncompressed, time-ordered NDJSON object with ranged GETs.
+// Probes that can't be parsed move the search towards the start, so the result is never too late.
+func seekTime(sess *session.Session, bucket string, key string, from time.Time) (int64, error) {
+	client := s3.New(sess)
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	lo, hi := int64(0), aws.Int64Value(head.ContentLength)
+	for hi-lo > seekProbe {
+		mid := lo + (hi-lo)/2
+		line, start, err := probeLine(client, bucket, key, mid)
+		if err != nil {
+			return 0, err
+		}
+
+		var record Record
+		if line == nil || json.Unmarshal(line, &record) != nil || !record.Time.Before(from) {
+			hi = mid
+			continue
+		}
+		lo = start
+	}
+	return lo, nil
+}
+
+// Return the first complete line starting after offset and its position
+func probeLine(client *s3.S3, bucket string, key string, offset int64) ([]byte, int64, error) {
+	object, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+seekProbe-1)),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	begin := bytes.IndexByte(data, '\n')
+	if begin < 0 {
+		return nil, 0, nil
+	}
+	end := bytes.IndexByte(data[begin+1:], '\n')
+	if end < 0 {
+		return nil, 0, nil
+	}
+	return data[begin+1 : begin+1+end], offset + int64(begin) + 1, nil
+}
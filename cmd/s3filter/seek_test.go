@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Serve an object with ranged GETs, counting them
+func rangeServer(object string, gets *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(object)))
+			return
+		}
+		atomic.AddInt32(gets, 1)
+		offset, end := 0, len(object)-1
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &offset, &end)
+		end = min(end, len(object)-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end, len(object)))
+		w.Header().Set("Content-Length", fmt.Sprint(end+1-offset))
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, object[offset:end+1])
+	}))
+}
+
+func TestSeekTime(t *testing.T) {
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	var object strings.Builder
+	var offsets []int
+	for i := 0; i < 20000; i++ {
+		offsets = append(offsets, object.Len())
+		if i%1000 == 500 {
+			// lines that can't be parsed only move the search towards the start
+			object.WriteString("garbage\n")
+			offsets[i] = object.Len()
+		}
+		fmt.Fprintf(&object, `{"id":%d,"time":"%s","words":["w"]}`+"\n", i, base.Add(time.Duration(i)*time.Second).Format(time.RFC3339))
+	}
+
+	var gets int32
+	server := rangeServer(object.String(), &gets)
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		from  time.Time
+		first int // the first record not before from
+	}{
+		{base.Add(-time.Hour), 0},
+		{base, 0},
+		{base.Add(10 * time.Second), 10},
+		{base.Add(12345 * time.Second), 12345},
+		{base.Add(12345*time.Second + time.Millisecond), 12346},
+		{base.Add(15500 * time.Second), 15500},
+		{base.Add(19999 * time.Second), 19999},
+		{base.Add(time.Hour * 24), 20000},
+	} {
+		target := object.Len()
+		if test.first < len(offsets) {
+			target = offsets[test.first]
+		}
+		gets = 0
+		got, err := seekTime(sess, "bucket", "key.json", test.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// never too late, at a line start, and within about a probe of the record
+		if got > int64(target) || (got > 0 && object.String()[got-1] != '\n') || int64(target)-got > seekProbe+100 {
+			t.Errorf("%s: seeked to %d, want a line start at most a probe before %d", test.from, got, target)
+		}
+		if gets > 8 {
+			t.Errorf("%s: %d probes, want a binary search", test.from, gets)
+		}
+	}
+}
+
+// Objects no larger than a probe are read from the start
+func TestSeekTimeSmall(t *testing.T) {
+	var gets int32
+	server := rangeServer(strings.Repeat(`{"id":1,"time":"2024-03-01T00:00:00Z"}`+"\n", 100), &gets)
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := seekTime(sess, "bucket", "key.json", time.Now()); got != 0 || err != nil || gets != 0 {
+		t.Errorf("got %d, %v after %d probes, want 0 without probing", got, err, gets)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Set by `-select`: the dotted paths of the fields kept in emitted records, nil to keep them all
+var Selected [][]string
+
+// Parse the field paths of `-select` (repeated or comma-separated)
+func parseSelect(values []string) ([][]string, error) {
+	var paths [][]string
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			path := strings.Split(field, ".")
+			for _, name := range path {
+				if name == "" {
+					return nil, fmt.Errorf("invalid field %q", field)
+				}
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// Keep only the fields of doc at the selected paths, nested as in doc; missing fields are left out
+func project(doc map[string]interface{}, paths [][]string) map[string]interface{} {
+	projected := map[string]interface{}{}
+	for _, path := range paths {
+		value, ok := lookup(doc, path)
+		if !ok {
+			continue
+		}
+		parent := projected
+		for _, name := range path[:len(path)-1] {
+			child, ok := parent[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[name] = child
+			}
+			parent = child
+		}
+		parent[path[len(path)-1]] = value
+	}
+	return projected
+}
+
+// Follow a path through nested objects, and arrays by element index
+func lookup(doc interface{}, path []string) (interface{}, bool) {
+	for _, name := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[name]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= len(container) {
+				return nil, false
+			}
+			doc = container[index]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
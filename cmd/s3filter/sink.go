@@ -0,0 +1,263 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/klauspost/compress/zstd"
+	"s3filter"
+)
+
+// Reconnection attempts and the pause between them for socket and pipe outputs
+const (
+	reconnectAttempts = 10
+	reconnectDelay    = time.Second
+)
+
+// Output opened from `-output`, closed at the end of the run
+var OutputCloser io.Closer
+
+// Set by `-output-compression`: `gzip`, `zstd` or `none`; empty follows the `-output` extension
+var OutputCompression string
+
+// Open an `-output` destination compressed as given: a local file, an S3 object (`s3://{bucket}/{key}`),
+// a Unix socket (`unix:///path/to.sock`) or a named pipe. Each connection to a socket or pipe is a compressed stream of its own.
+func openOutput(spec string, compression string) (io.WriteCloser, error) {
+	if strings.HasPrefix(spec, "unix://") {
+		path := strings.TrimPrefix(spec, "unix://")
+		return newReconnectingWriter(spec, func() (io.WriteCloser, error) {
+			conn, err := net.Dial("unix", path)
+			if err != nil {
+				return nil, err
+			}
+			return compressOutput(conn, compression, true)
+		})
+	}
+
+	var dst io.WriteCloser
+	var err error
+	switch {
+	case strings.HasPrefix(spec, "s3://"):
+		dst, err = newUploadWriter(spec)
+	case isNamedPipe(spec):
+		return newReconnectingWriter(spec, func() (io.WriteCloser, error) {
+			// blocks until a consumer opens the pipe for reading
+			pipe, err := os.OpenFile(spec, os.O_WRONLY, 0)
+			if err != nil {
+				return nil, err
+			}
+			return compressOutput(pipe, compression, true)
+		})
+	default:
+		dst, err = os.Create(spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return compressOutput(dst, compression, false)
+}
+
+func isNamedPipe(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// Writer streaming into a multipart upload, which completes when it is closed
+type uploadWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+// Start uploading to an S3 object with the `-output-*` settings
+func newUploadWriter(uri string) (*uploadWriter, error) {
+	bucket, key, err := s3filter.ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+	client := s3.New(sess)
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String("application/x-ndjson"),
+	}
+	if err = lockUpload(client, input); err != nil {
+		return nil, err
+	}
+	if err = classifyUpload(input); err != nil {
+		return nil, err
+	}
+	if err = grantUpload(client, input); err != nil {
+		return nil, err
+	}
+	preflightOutput(sess, client, bucket, aws.StringValue(input.ACL))
+
+	reader, writer := io.Pipe()
+	input.Body = reader
+	w := &uploadWriter{PipeWriter: writer, done: make(chan error, 1)}
+	go func() {
+		_, err := s3manager.NewUploader(sess).Upload(input)
+		if err != nil {
+			err = explainLocked(client, bucket, key, err)
+		}
+		// a failed upload no longer reads, so fail the writes rather than block them
+		reader.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+// Complete the upload
+func (w *uploadWriter) Close() error {
+	w.PipeWriter.Close()
+	return <-w.done
+}
+
+// Give up the upload, leaving no object (or multipart upload parts) behind
+func (w *uploadWriter) abort(err error) {
+	w.PipeWriter.CloseWithError(err)
+	<-w.done
+}
+
+// Abandon an `-output` upload of a failed run rather than complete it with partial results
+func abortOutput(reason string) {
+	if upload, ok := OutputCloser.(interface{ abort(error) }); ok {
+		OutputCloser = nil
+		upload.abort(errors.New(reason))
+	}
+}
+
+// The `-output-compression` of an output, by default `gzip` for `.gz` and `zstd` for `.zst` destinations.
+// There is no bzip2 encoder, so a `.bz2` destination needs the compression given explicitly.
+func outputCompression(spec string) (string, error) {
+	switch OutputCompression {
+	case "":
+		switch {
+		case strings.HasSuffix(spec, ".gz"):
+			return s3filter.Gzip, nil
+		case strings.HasSuffix(spec, ".zst"):
+			return s3filter.Zstd, nil
+		case strings.HasSuffix(spec, ".bz2"):
+			return "", fmt.Errorf("bzip2 output is not supported, set `-output-compression` to write %s", spec)
+		}
+		return s3filter.Plain, nil
+	case "none":
+		return s3filter.Plain, nil
+	case s3filter.Gzip, s3filter.Zstd:
+		return OutputCompression, nil
+	}
+	return "", fmt.Errorf("unknown output compression %q, expected `gzip`, `zstd` or `none`", OutputCompression)
+}
+
+// Writer compressing into an output, which it closes after the end of the compressed stream
+type compressedWriter struct {
+	io.WriteCloser
+	dst   io.WriteCloser
+	flush func() error // after every Write, when set
+}
+
+// Compress what is written to dst with the given compression.
+// A flushed stream delivers every Write whole, so a reconnected consumer only misses the batch being retried.
+func compressOutput(dst io.WriteCloser, compression string, flushed bool) (io.WriteCloser, error) {
+	var w *compressedWriter
+	switch compression {
+	case s3filter.Gzip:
+		enc := gzip.NewWriter(dst)
+		w = &compressedWriter{WriteCloser: enc, dst: dst, flush: enc.Flush}
+	case s3filter.Zstd:
+		enc, err := zstd.NewWriter(dst)
+		if err != nil {
+			return nil, err
+		}
+		w = &compressedWriter{WriteCloser: enc, dst: dst, flush: enc.Flush}
+	default:
+		return dst, nil
+	}
+	if !flushed {
+		w.flush = nil
+	}
+	return w, nil
+}
+
+func (w *compressedWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	if err == nil && w.flush != nil {
+		err = w.flush()
+	}
+	return n, err
+}
+
+func (w *compressedWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if closeErr := w.dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (w *compressedWriter) abort(err error) {
+	if upload, ok := w.dst.(interface{ abort(error) }); ok {
+		upload.abort(err)
+	}
+}
+
+// Writer that reopens its destination when the consumer goes away.
+// Records are written in whole batches of one Write each, which is retried as a whole on the new connection.
+type reconnectingWriter struct {
+	name string
+	open func() (io.WriteCloser, error)
+	conn io.WriteCloser
+}
+
+func newReconnectingWriter(name string, open func() (io.WriteCloser, error)) (*reconnectingWriter, error) {
+	conn, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &reconnectingWriter{name: name, open: open, conn: conn}, nil
+}
+
+func (w *reconnectingWriter) Write(p []byte) (int, error) {
+	var err error
+	for attempt := 0; attempt <= reconnectAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(reconnectDelay)
+		}
+
+		if w.conn == nil {
+			if w.conn, err = w.open(); err != nil {
+				w.conn = nil
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "Reconnected to", w.name)
+		}
+
+		var n int
+		if n, err = w.conn.Write(p); err == nil {
+			return n, nil
+		}
+		fmt.Fprintf(os.Stderr, "Lost connection to %s: %v\n", w.name, err)
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+func (w *reconnectingWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Connection to a consumer, which has gone away once broken
+type testConn struct {
+	bytes.Buffer
+	broken bool
+}
+
+func (c *testConn) Write(p []byte) (int, error) {
+	if c.broken {
+		return 0, errors.New("broken pipe")
+	}
+	return c.Buffer.Write(p)
+}
+
+func (c *testConn) Close() error { return nil }
+
+func TestCompressedReconnect(t *testing.T) {
+	for _, compression := range []string{"gzip", "zstd"} {
+		var conns []*testConn
+		w, err := newReconnectingWriter("test", func() (io.WriteCloser, error) {
+			conn := &testConn{}
+			conns = append(conns, conn)
+			return compressOutput(conn, compression, true)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, batch := range []string{"{\"id\":1}\n", "{\"id\":2}\n", "{\"id\":3}\n"} {
+			if _, err = w.Write([]byte(batch)); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				// the consumer goes away after the first batch
+				conns[0].broken = true
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(conns) != 2 {
+			t.Fatalf("%s: %d connections, want 2", compression, len(conns))
+		}
+
+		// each connection got a stream of its own, the first cut short after the batch it delivered
+		for i, want := range []string{"{\"id\":1}\n", "{\"id\":2}\n{\"id\":3}\n"} {
+			var reader io.Reader
+			if compression == "gzip" {
+				if reader, err = gzip.NewReader(&conns[i].Buffer); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				dec, err := zstd.NewReader(&conns[i].Buffer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer dec.Close()
+				reader = dec
+			}
+			got := make([]byte, len(want))
+			if _, err = io.ReadFull(reader, got); err != nil || string(got) != want {
+				t.Errorf("%s: connection %d delivered %q, %v; want %q", compression, i+1, got, err, want)
+			}
+		}
+	}
+}
+
+func TestOutputCompression(t *testing.T) {
+	defer func() { OutputCompression = "" }()
+	for _, test := range []struct {
+		flag, spec, want string
+	}{
+		{"", "s3://bucket/out.ndjson", ""},
+		{"", "s3://bucket/out.ndjson.gz", "gzip"},
+		{"", "s3://bucket/out.ndjson.zst", "zstd"},
+		{"", "s3://bucket/out.ndjson.bz2", "error"},
+		{"gzip", "s3://bucket/out.ndjson.bz2", "gzip"},
+		{"none", "s3://bucket/out.ndjson.gz", ""},
+		{"lz4", "out.ndjson", "error"},
+	} {
+		OutputCompression = test.flag
+		got, err := outputCompression(test.spec)
+		if err != nil {
+			got = "error"
+		}
+		if got != test.want {
+			t.Errorf("-output-compression %q of %s: got %s, want %s", test.flag, test.spec, got, test.want)
+		}
+	}
+}
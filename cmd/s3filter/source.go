@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"s3filter"
+)
+
+// Set by `-use-fips`
+var UseFIPS bool
+
+// Set by `-endpoint-url` and `-force-path-style`, for S3 compatible stores such as MinIO, Ceph RGW and LocalStack.
+// They default to `AWS_ENDPOINT_URL_S3` (or `AWS_ENDPOINT_URL`) and `AWS_S3_FORCE_PATH_STYLE`, which subcommands use as well.
+var (
+	EndpointURL       = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	ForcePathStyle, _ = strconv.ParseBool(os.Getenv("AWS_S3_FORCE_PATH_STYLE"))
+)
+
+// Set by `-profile` and `-region`: the named profile of the shared AWS configuration and the region, overriding `AWS_PROFILE` and `AWS_REGION`
+var (
+	Profile string
+	Region  string
+)
+
+// Set by `-role-arn`, `-external-id`, `-session-name` and `-role-duration`: a role assumed with the base credentials
+var (
+	RoleARN      string
+	ExternalID   string
+	SessionName  = "s3filter"
+	RoleDuration time.Duration
+)
+
+// The value of the first of the environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Create the AWS session shared by all S3 operations
+func newSession() (*session.Session, error) {
+	// name every provider tried when no credentials are found
+	config := aws.NewConfig().WithCredentialsChainVerboseErrors(true).
+		// access point ARNs carry their own region and partition
+		WithS3UseARNRegion(true)
+	if UseFIPS {
+		config.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+	if EndpointURL != "" {
+		// only S3 requests go to the custom endpoint; STS and the other services keep theirs
+		config.EndpointResolver = endpoints.ResolverFunc(func(service, region string, options ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+			if service == endpoints.S3ServiceID {
+				return endpoints.ResolvedEndpoint{URL: EndpointURL, SigningRegion: region}, nil
+			}
+			return endpoints.DefaultResolver().EndpointFor(service, region, options...)
+		})
+	}
+	if ForcePathStyle {
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	if client := ceilingClient(); client != nil {
+		config.HTTPClient = client
+	}
+	if Region != "" {
+		config.Region = aws.String(Region)
+	}
+	// honor ~/.aws/config as the AWS CLI does, prompting for the MFA code of profiles that require one
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:                  *config,
+		Profile:                 Profile,
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if RoleARN != "" {
+		// refreshed by assuming the role again before the credentials expire
+		sess = sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(sess, RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = SessionName
+			if ExternalID != "" {
+				p.ExternalID = aws.String(ExternalID)
+			}
+			if RoleDuration > 0 {
+				p.Duration = RoleDuration
+			}
+		})})
+	}
+	sess.Handlers.Retry.PushBackNamed(refreshExpiredCredentials)
+	sess.Handlers.Complete.PushBackNamed(meterRequests)
+	if PrintIdentity {
+		if err = printIdentity(sess); err != nil {
+			return nil, fmt.Errorf("unable to resolve identity: %w", err)
+		}
+	}
+	return sess, nil
+}
+
+// Retry requests rejected because the session credentials expired mid-run.
+// The SDK expires its cached credentials before a retry, so the provider (environment, profile, assumed role, instance role) is asked for fresh ones and the request is signed again.
+var refreshExpiredCredentials = request.NamedHandler{
+	Name: "s3filter.RefreshExpiredCredentials",
+	Fn: func(r *request.Request) {
+		if r.IsErrorExpired() && r.RetryCount < r.MaxRetries() {
+			incident("Credentials expired during %s, refreshing and retrying", r.Operation.Name)
+			r.Retryable = aws.Bool(true)
+		}
+	},
+}
+
+// Download an object from AWS S3 to memory, as parallel ranged GETs (a single stream from Object Lambda access points).
+// A stalled GET is resumed where it stopped rather than starting the object over.
+func download(sess *session.Session, bucket string, key string) ([]byte, error) {
+	data, err := transfer().Download(context.Background(), sess, bucket, key)
+	if errors.Is(err, context.DeadlineExceeded) {
+		incident("Download of s3://%s/%s exceeded -object-timeout %v", bucket, key, ObjectTimeout)
+	}
+	return data, err
+}
+
+// Open an object from offset as a single stream, so reading can stop (and the transfer be aborted) at any point.
+// A connection that stalls is replaced by one resuming where it stopped.
+func openObject(sess *session.Session, bucket string, key string, offset int64) (io.ReadCloser, error) {
+	return transfer().OpenObject(context.Background(), sess, bucket, key, offset)
+}
+
+// Expand the inputs into object URIs.
+// Prefixes (inputs ending in `/`, or every S3 input with `-recursive`) are replaced by the objects listed under them,
+// from the beginning `-key-pattern` fixes on; listed and named objects alike are pruned by `-key-pattern` and `-shard`.
+func expandInputs(client *s3.S3, inputs []string) ([]string, error) {
+	var uris []string
+	for _, input := range inputs {
+		// URLs can't be listed
+		if isURL(input) {
+			uris = append(uris, input)
+			continue
+		}
+		if !*Recursive && !strings.HasSuffix(input, "/") {
+			// an invalid URI fails as its object is filtered
+			if _, key, err := s3filter.ParseURI(input); err != nil || KeyFilter == nil || KeyFilter.admits(key) {
+				uris = append(uris, input)
+			}
+			continue
+		}
+
+		bucket, prefix, err := s3filter.ParsePrefix(input)
+		if err != nil {
+			return nil, err
+		}
+		if KeyFilter != nil && (prefix == "" || strings.HasSuffix(prefix, "/")) {
+			prefix += KeyFilter.prefix()
+		}
+		objects, err := s3filter.ListObjects(client, bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			key := aws.StringValue(object.Key)
+			if KeyFilter != nil && !KeyFilter.admits(key) {
+				continue
+			}
+			// sidecars hold the counts of the objects next to them
+			if VerifyCount && strings.HasSuffix(key, countSuffix) {
+				continue
+			}
+			if Tracker != nil {
+				Tracker.expect(aws.Int64Value(object.Size))
+			}
+			uris = append(uris, fmt.Sprintf("s3://%s/%s", bucket, key))
+		}
+	}
+	return uris, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Per-object status record emitted by multi-object runs to `-status-output`
+type ObjectStatus struct {
+	Key      string  `json:"key"`
+	Status   string  `json:"status"`
+	Matches  int64   `json:"matches"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+	Output   string  `json:"output,omitempty"`
+}
+
+// Destination of the status records, nil unless `-status-output` is set
+var StatusLog *json.Encoder
+
+// Whether the status records go to stdout, which the records then can't
+var statusToStdout bool
+
+// Open the `-status-output` destination: `-` for stdout, `stderr`, or a local file
+func openStatusLog(path string) error {
+	statusToStdout = path == "-"
+	switch path {
+	case "-":
+		StatusLog = json.NewEncoder(os.Stdout)
+	case "stderr":
+		StatusLog = json.NewEncoder(os.Stderr)
+	default:
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		StatusLog = json.NewEncoder(file)
+	}
+	return nil
+}
+
+// Emit the status of one processed object
+func writeStatus(key string, status string, matches int64, err error, start time.Time, output string) error {
+	if StatusLog == nil {
+		return nil
+	}
+
+	record := ObjectStatus{
+		Key:      key,
+		Status:   status,
+		Matches:  matches,
+		Duration: time.Since(start).Seconds(),
+		Output:   output,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err = StatusLog.Encode(record); err != nil {
+		return fmt.Errorf("unable to write status of %s: %w", key, err)
+	}
+	return nil
+}
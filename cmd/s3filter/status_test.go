@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWriteStatus(t *testing.T) {
+	defer func(log *json.Encoder) { StatusLog = log }(StatusLog)
+	var out bytes.Buffer
+	StatusLog = json.NewEncoder(&out)
+	if err := writeStatus("s3://b/k", "failed", 2, errors.New("denied"), time.Now(), "s3://out/matches.json"); err != nil {
+		t.Fatal(err)
+	}
+	var status ObjectStatus
+	if err := json.Unmarshal(out.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Key != "s3://b/k" || status.Status != "failed" || status.Matches != 2 || status.Error != "denied" || status.Output != "s3://out/matches.json" {
+		t.Errorf("wrote %+v", status)
+	}
+
+	StatusLog = json.NewEncoder(failingWriter{})
+	if err := writeStatus("s3://b/k", "filtered", 0, nil, time.Now(), ""); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("got %v, want the write error", err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"s3filter"
+)
+
+// Metadata key recording the ETag of the source object a filtered copy was produced from
+const sourceETagKey = "S3filter-Source-Etag"
+
+// Metadata key recording the criteria digest a filtered copy was produced with
+const criteriaKey = "S3filter-Criteria"
+
+// Flags that decide which records a filtered copy keeps and how they are written
+var criteriaFlags = []string{
+	"with-id", "with-id-file", "with-word", "without-word", "word-match", "with-word-regex", "with-word-regex-file",
+	"query", "expr", "where", "select", "policy", "tokenize", "tokenize-url", "cast", "rename",
+	"validate-schema", "on-invalid", "on-malformed", "format", "input-encoding", "no-decompress",
+	"from-time", "to-time", "context", "first", "last", "by", "limit",
+	"hash-chain", "escape-html", "ascii-only", "line-ending",
+}
+
+// `s3filter sync [flags] -src s3://{bucket}/{prefix} -dst s3://{bucket}/{prefix}`
+// Maintain the destination prefix as a filtered mirror of the source prefix.
+// Only source objects that are new, whose ETag changed or that were filtered with other criteria since the last sync are processed.
+func runSync(args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	src := flags.String("src", "", "An S3 URI (`s3://{bucket}/{prefix}`) of the source prefix.")
+	dst := flags.String("dst", "", "An S3 URI (`s3://{bucket}/{prefix}`) of the destination prefix.")
+	remove := flags.Bool("delete", false, "Delete destination objects whose source object no longer exists.")
+	atomic := flags.Bool("atomic", false, "Stage the filtered objects under "+stagingRoot+" in the destination bucket, and publish them to the destination prefix "+
+		"with server-side copies only once every object was filtered, so a failed run changes nothing downstream loaders see. "+
+		"Deletes and the manifest follow the publishing.")
+	manifest := flags.String("manifest", "", "Emit what a warehouse needs to query the destination as an external table: `redshift` (Spectrum manifest and DDL) or `snowflake` (stage and DDL).")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: s3filter sync [flags] -src s3://{bucket}/{prefix} -dst s3://{bucket}/{prefix}")
+		flags.PrintDefaults()
+	}
+	processArgs(flags, args)
+	if *src == "" || *dst == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+	start := time.Now()
+	S3URI = src
+
+	srcBucket, srcPrefix, err := s3filter.ParsePrefix(*src)
+	if err != nil {
+		exitErrorf("%v", err)
+	}
+	dstBucket, dstPrefix, err := s3filter.ParsePrefix(*dst)
+	if err != nil {
+		exitErrorf("%v", err)
+	}
+	var stage string
+	if *atomic {
+		if strings.HasPrefix(dstPrefix, stagingRoot) {
+			exitErrorf("the destination of `-atomic` cannot be under %s, where it stages objects", stagingRoot)
+		}
+		stage = stagingPrefix(dstPrefix, start)
+	}
+
+	sess, err := newSession()
+	if err != nil {
+		exitErrorf("Failed to create new session. %v\n", err)
+	}
+	client := s3.New(sess)
+
+	listed, err := s3filter.ListObjects(client, srcBucket, srcPrefix)
+	if err != nil {
+		exitErrorf("Unable to list %s %v", *src, err)
+	}
+
+	// Keys outside the time window or shards are left alone, neither copied nor deleted
+	var sources []*s3.Object
+	mirrored := make(map[string]bool, len(listed))
+	for _, object := range listed {
+		mirrored[strings.TrimPrefix(aws.StringValue(object.Key), srcPrefix)] = true
+		if KeyFilter == nil || KeyFilter.admits(aws.StringValue(object.Key)) {
+			sources = append(sources, object)
+		}
+	}
+	targets, err := s3filter.ListObjects(client, dstBucket, dstPrefix)
+	if err != nil {
+		exitErrorf("Unable to list %s %v", *dst, err)
+	}
+
+	if Tracker != nil {
+		for _, object := range sources {
+			Tracker.expect(aws.Int64Value(object.Size))
+		}
+	}
+
+	existing := make(map[string]bool, len(targets))
+	for _, object := range targets {
+		existing[strings.TrimPrefix(aws.StringValue(object.Key), dstPrefix)] = true
+	}
+
+	var copied, skipped int
+	var staged []string
+	for _, object := range sources {
+		started, matched := time.Now(), Matched
+		name := strings.TrimPrefix(aws.StringValue(object.Key), srcPrefix)
+		dstKey := dstPrefix + name
+		srcURI := fmt.Sprintf("s3://%s/%s", srcBucket, aws.StringValue(object.Key))
+		dstURI := fmt.Sprintf("s3://%s/%s", dstBucket, dstKey)
+
+		if existing[name] {
+			etag, digest, err := copiedFrom(client, dstBucket, dstKey)
+			if err != nil {
+				if statusErr := writeStatus(srcURI, "failed", 0, err, started, dstURI); statusErr != nil {
+					exitErrorf("%v", statusErr)
+				}
+				objectFailed(dstURI, err)
+				continue
+			}
+			if etag == aws.StringValue(object.ETag) && digest == CriteriaDigest {
+				if err := writeStatus(srcURI, "unchanged", 0, nil, started, dstURI); err != nil {
+					exitErrorf("%v", err)
+				}
+				skipped++
+				continue
+			}
+		}
+
+		target := dstURI
+		if *atomic {
+			target = fmt.Sprintf("s3://%s/%s%s", dstBucket, stage, name)
+		}
+		if err = copyObject(sess, srcURI, target, *atomic); err != nil {
+			if statusErr := writeStatus(srcURI, "failed", Matched-matched, err, started, dstURI); statusErr != nil {
+				exitErrorf("%v", statusErr)
+			}
+			if *atomic && !*KeepGoing {
+				discardStaged(client, dstBucket, stage)
+			}
+			objectFailed(srcURI, err)
+			continue
+		}
+		if err := writeStatus(srcURI, "copied", Matched-matched, nil, started, dstURI); err != nil {
+			exitErrorf("%v", err)
+		}
+		staged = append(staged, name)
+		copied++
+	}
+
+	if *atomic {
+		if len(Failures) > 0 {
+			discardStaged(client, dstBucket, stage)
+			reportFailures()
+			exitErrorf("Nothing was published to %s, as %d objects failed", *dst, len(Failures))
+		}
+		for _, name := range staged {
+			if err = publishObject(sess, dstBucket, stage+name, dstPrefix+name); err != nil {
+				if !*KeepGoing {
+					discardStaged(client, dstBucket, stage)
+				}
+				objectFailed(fmt.Sprintf("s3://%s/%s%s", dstBucket, dstPrefix, name), err)
+			}
+		}
+		discardStaged(client, dstBucket, stage)
+	}
+
+	var deleted int
+	if *remove {
+		for name := range existing {
+			if mirrored[name] {
+				continue
+			}
+			_, err = client.DeleteObject(&s3.DeleteObjectInput{
+				Bucket: aws.String(dstBucket),
+				Key:    aws.String(dstPrefix + name),
+			})
+			if err != nil {
+				err = explainLocked(client, dstBucket, dstPrefix+name, err)
+				objectFailed(fmt.Sprintf("s3://%s/%s%s", dstBucket, dstPrefix, name), err)
+				continue
+			}
+			deleted++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Sync: %d copied, %d unchanged, %d deleted\n", copied, skipped, deleted)
+	if *manifest != "" {
+		if err = emitManifest(sess, *manifest, dstBucket, dstPrefix); err != nil {
+			exitErrorf("Unable to emit %s manifest %v", *manifest, err)
+		}
+	}
+	report(start)
+}
+
+// Return the source ETag and criteria digest recorded on a filtered copy
+func copiedFrom(client *s3.S3, bucket string, key string) (etag string, digest string, err error) {
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	for name, value := range head.Metadata {
+		switch {
+		case strings.EqualFold(name, sourceETagKey):
+			etag = aws.StringValue(value)
+		case strings.EqualFold(name, criteriaKey):
+			digest = aws.StringValue(value)
+		}
+	}
+	return etag, digest, nil
+}
+
+// Hash the values of the criteria flags, defaults included, so the same criteria give the same digest
+// however they were given. Files named by the flags are identified by their path, not their content.
+func criteriaDigest(flags *flag.FlagSet) string {
+	values := map[string]interface{}{}
+	for _, name := range criteriaFlags {
+		if f := flags.Lookup(name); f != nil {
+			values[name] = flagValue(f)
+		}
+	}
+	// map keys are sorted, so the encoding is stable
+	data, _ := json.Marshal(values)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
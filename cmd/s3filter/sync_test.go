@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+// The digest of the criteria after parsing args as main does
+func digestOf(t *testing.T, args ...string) string {
+	t.Helper()
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	processArgs(flags, append([]string{"-history", "off"}, args...))
+	// a value given to a bool flag would be taken for an input
+	if flags.NArg() > 0 {
+		t.Fatalf("%q left unparsed", flags.Args())
+	}
+	for _, name := range criteriaFlags {
+		if flags.Lookup(name) == nil {
+			t.Fatalf("criteria flag -%s is not defined", name)
+		}
+	}
+	return CriteriaDigest
+}
+
+func TestCriteriaDigest(t *testing.T) {
+	base := digestOf(t, "-with-word", "a")
+	if again := digestOf(t, "-with-word", "a", "-workers", "4"); again != base {
+		t.Errorf("-workers changed the digest: %s != %s", again, base)
+	}
+	if other := digestOf(t, "-with-word", "b"); other == base {
+		t.Error("changing -with-word kept the digest")
+	}
+	if other := digestOf(t, "-with-word", "a", "-first"); other == base {
+		t.Error("adding -first kept the digest")
+	}
+	if other := digestOf(t, "-with-word", "a", "-limit", "0"); other != base {
+		t.Errorf("the default -limit changed the digest: %s != %s", other, base)
+	}
+	limited := digestOf(t, "-with-word", "a", "-limit", "10")
+	if limited == base {
+		t.Error("adding -limit kept the digest")
+	}
+	if other := digestOf(t, "-with-word", "a", "-limit", "20"); other == limited {
+		t.Error("changing -limit kept the digest")
+	}
+}
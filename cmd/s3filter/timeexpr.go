@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse a `-from-time` or `-to-time` expression against the clock now:
+//
+//	2024-06-01T12:00:00Z   an RFC3339 timestamp
+//	2024-06-01             a UTC date; as an end of range it covers the whole day
+//	now, now-7d, now+1h    now, or an offset from it
+//	-24h, -2w              an offset from now
+//
+// Offsets are Go durations, with `d` (24h) and `w` (7d) added.
+func parseTimeExpr(expr string, now time.Time, end bool) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	if t, err := time.Parse(time.RFC3339, expr); err == nil {
+		return t, nil
+	}
+	if day, err := time.Parse("2006-01-02", expr); err == nil {
+		if end {
+			return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return day, nil
+	}
+
+	offset := expr
+	if rest, ok := strings.CutPrefix(expr, "now"); ok {
+		if rest == "" {
+			return now, nil
+		}
+		offset = rest
+	}
+	if !strings.HasPrefix(offset, "-") && !strings.HasPrefix(offset, "+") {
+		return time.Time{}, fmt.Errorf("%q is not an RFC3339 timestamp, a date (2006-01-02) or a time relative to now (-24h, now-7d)", expr)
+	}
+	d, err := parseOffset(offset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q: %v", expr, err)
+	}
+	return now.Add(d), nil
+}
+
+// Parse a signed Go duration that may also use days (`d`) and weeks (`w`), e.g. `-7d` or `+1w2d3h`
+func parseOffset(offset string) (time.Duration, error) {
+	sign := time.Duration(1)
+	if offset[0] == '-' {
+		sign = -1
+	}
+	rest := offset[1:]
+	if rest == "" || strings.HasPrefix(rest, "-") || strings.HasPrefix(rest, "+") {
+		return 0, fmt.Errorf("invalid offset %q", offset)
+	}
+
+	var total time.Duration
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}} {
+		i := strings.Index(rest, unit.suffix)
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset %q", offset)
+		}
+		total += time.Duration(n) * unit.size
+		rest = rest[i+1:]
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, err
+		}
+		total += d
+	}
+	return sign * total, nil
+}
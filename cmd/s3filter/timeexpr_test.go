@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeExpr(t *testing.T) {
+	now := time.Date(2024, 6, 10, 15, 30, 0, 0, time.UTC)
+	for _, test := range []struct {
+		expr string
+		end  bool
+		want time.Time
+	}{
+		{"2024-06-01T12:00:00Z", false, time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{"2024-06-01T12:00:00+02:00", true, time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{" 2024-06-01T12:00:00.5Z ", false, time.Date(2024, 6, 1, 12, 0, 0, 5e8, time.UTC)},
+		// a date starts at midnight UTC, and as an end of range covers the whole day
+		{"2024-06-01", false, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-06-01", true, time.Date(2024, 6, 1, 23, 59, 59, 999999999, time.UTC)},
+		{"2024-12-31", true, time.Date(2024, 12, 31, 23, 59, 59, 999999999, time.UTC)},
+		// relative times don't depend on end
+		{"now", false, now},
+		{"now", true, now},
+		{"now-7d", false, now.AddDate(0, 0, -7)},
+		{"now+1h", true, now.Add(time.Hour)},
+		{"-24h", false, now.Add(-24 * time.Hour)},
+		{"-2w", false, now.AddDate(0, 0, -14)},
+		{"+1w2d3h30m", false, now.Add(9*24*time.Hour + 3*time.Hour + 30*time.Minute)},
+		{"now-1d12h", false, now.Add(-36 * time.Hour)},
+		{"-90s", false, now.Add(-90 * time.Second)},
+	} {
+		got, err := parseTimeExpr(test.expr, now, test.end)
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("%q (end %v): got %s, %v, want %s", test.expr, test.end, got, err, test.want)
+		}
+	}
+}
+
+func TestParseTimeExprErrors(t *testing.T) {
+	now := time.Date(2024, 6, 10, 15, 30, 0, 0, time.UTC)
+	for _, expr := range []string{
+		"",
+		"yesterday",
+		"2024-06-01 12:00",
+		"2024-13-01",
+		"24h",
+		"now7d",
+		"now-",
+		"-",
+		"now--1h",
+		"-+1d",
+		"-1.5d",
+		"-d",
+		"-1d2w",
+		"-1x",
+		"-1h1d",
+	} {
+		if got, err := parseTimeExpr(expr, now, false); err == nil {
+			t.Errorf("%q: got %s, want an error", expr, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Tokenizer replaces an identifier value with its pseudonymous token
+type Tokenizer interface {
+	Token(value string) (string, error)
+}
+
+// Tokenizer backed by the tokenization service HTTP API.
+// It POSTs `{"value": ...}` and expects `{"token": ...}` in response.
+// Tokens are cached so every distinct value costs one request per run.
+type httpTokenizer struct {
+	url    string
+	client *http.Client
+	cache  map[string]string
+}
+
+func newHTTPTokenizer(url string) *httpTokenizer {
+	return &httpTokenizer{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+		cache:  make(map[string]string),
+	}
+}
+
+func (t *httpTokenizer) Token(value string) (string, error) {
+	if token, ok := t.cache[value]; ok {
+		return token, nil
+	}
+
+	payload, err := json.Marshal(map[string]string{"value": value})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("tokenization service returned %s", resp.Status)
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.Token == "" {
+		return "", fmt.Errorf("tokenization service returned an empty token")
+	}
+
+	t.cache[value] = result.Token
+	return result.Token, nil
+}
+
+// Replace the configured identifier fields of doc with tokens
+func tokenize(doc map[string]interface{}, fields []string, tokenizer Tokenizer) error {
+	for _, field := range fields {
+		value, ok := doc[field]
+		if !ok {
+			continue
+		}
+
+		switch v := value.(type) {
+		case []string:
+			tokens := make([]string, len(v))
+			for i, item := range v {
+				token, err := tokenizer.Token(item)
+				if err != nil {
+					return fmt.Errorf("tokenization failed for field %s: %v", field, err)
+				}
+				tokens[i] = token
+			}
+			doc[field] = tokens
+		case time.Time:
+			token, err := tokenizer.Token(v.Format(time.RFC3339Nano))
+			if err != nil {
+				return fmt.Errorf("tokenization failed for field %s: %v", field, err)
+			}
+			doc[field] = token
+		default:
+			token, err := tokenizer.Token(fmt.Sprint(v))
+			if err != nil {
+				return fmt.Errorf("tokenization failed for field %s: %v", field, err)
+			}
+			doc[field] = token
+		}
+	}
+	return nil
+}
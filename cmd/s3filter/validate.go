@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+// JSON Schema record contract, validated with github.com/santhosh-tekuri/jsonschema.
+// Every keyword of the schema's draft (2020-12 without `$schema`) is enforced, `format` included;
+// `$ref`s are resolved against the schema file.
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+// Schema violation counters keyed by rule (`{path} {keyword}`, with `*` for any array index),
+// and the invalid records dropped because they could not be decoded to be tagged
+var (
+	Violations      = map[string]int64{}
+	InvalidRecords  int64
+	UntaggedInvalid int64
+)
+
+// Read and compile a schema file
+func loadSchema(path string) (*Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	schema, err := compiler.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %v", path, err)
+	}
+	return &Schema{schema: schema}, nil
+}
+
+// A violated rule at the path of the value breaking it, e.g. `/words/3 type` of the rule `/words/* type`
+type violation struct {
+	at   string
+	rule string
+}
+
+// Validate a raw record and return the violations at their paths, counting them by rule
+func (s *Schema) check(raw []byte) ([]string, error) {
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	err = s.schema.Validate(value)
+	if err == nil {
+		return nil, nil
+	}
+	invalid, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, err
+	}
+
+	var found []violation
+	collectViolations(invalid, value, &found)
+	sort.Slice(found, func(i, j int) bool { return found[i].at < found[j].at })
+	InvalidRecords++
+	violations := make([]string, len(found))
+	for i, v := range found {
+		Violations[v.rule]++
+		violations[i] = v.at
+	}
+	return violations, nil
+}
+
+// Collect the innermost errors under e as violations. Of `anyOf` and `oneOf`, which pass when
+// some alternative does, the keyword itself is the violation rather than every alternative's.
+func collectViolations(e *jsonschema.ValidationError, value interface{}, found *[]violation) {
+	switch e.ErrorKind.(type) {
+	case *kind.AnyOf, *kind.OneOf:
+	default:
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				collectViolations(cause, value, found)
+			}
+			return
+		}
+	}
+
+	path, rule := "", ""
+	for _, name := range e.InstanceLocation {
+		// array indexes make rules of their own, so they are counted as `*`
+		if items, ok := value.([]interface{}); ok {
+			index, _ := strconv.Atoi(name)
+			value = items[index]
+			path, rule = path+"/"+name, rule+"/*"
+			continue
+		}
+		value = value.(map[string]interface{})[name]
+		path, rule = path+"/"+name, rule+"/"+name
+	}
+
+	keyword := strings.Join(e.ErrorKind.KeywordPath(), "/")
+	switch k := e.ErrorKind.(type) {
+	case *kind.Required:
+		for _, field := range k.Missing {
+			*found = append(*found, violation{path + "/" + field + " " + keyword, rule + "/" + field + " " + keyword})
+		}
+		return
+	case *kind.AdditionalProperties:
+		for _, field := range k.Properties {
+			*found = append(*found, violation{path + "/" + field + " " + keyword, rule + "/" + field + " " + keyword})
+		}
+		return
+	}
+	if path == "" {
+		path, rule = "/", "/"
+	}
+	*found = append(*found, violation{path + " " + keyword, rule + " " + keyword})
+}
+
+// Print violation counts by rule to stderr
+func reportViolations() {
+	fmt.Fprintf(os.Stderr, "Schema validation: %d invalid records\n", InvalidRecords)
+	if UntaggedInvalid > 0 {
+		fmt.Fprintf(os.Stderr, "  %d invalid records dropped as they could not be decoded to be tagged\n", UntaggedInvalid)
+	}
+
+	rules := make([]string, 0, len(Violations))
+	for rule := range Violations {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		fmt.Fprintf(os.Stderr, "  %s: %d\n", rule, Violations[rule])
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	schema := `{"type": "object", "required": ["id"], "properties": {"words": {"type": "array", "items": {"type": "string"}}}}`
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Violations, InvalidRecords = map[string]int64{}, 0
+	for _, raw := range []string{`{"id": 1, "words": ["a", 3, true]}`, `{"words": [1]}`, `{"id": 2, "words": []}`} {
+		if _, err := s.check([]byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]int64{"/words/* type": 3, "/id required": 1}
+	if !reflect.DeepEqual(Violations, want) || InvalidRecords != 2 {
+		t.Errorf("%d invalid records violating %v, want 2 violating %v", InvalidRecords, Violations, want)
+	}
+
+	violations, err := s.check([]byte(`{"id": 3, "words": ["a", 2]}`))
+	if err != nil || !reflect.DeepEqual(violations, []string{"/words/1 type"}) {
+		t.Errorf("violations %v, %v; want the path of the element", violations, err)
+	}
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	schema := `{
+		"$defs": {"id": {"type": "integer", "exclusiveMinimum": 0}},
+		"type": "object",
+		"properties": {
+			"id": {"$ref": "#/$defs/id"},
+			"kind": {"const": "event"},
+			"time": {"type": "string", "format": "date-time"},
+			"user": {"anyOf": [{"type": "string"}, {"type": "object", "required": ["name"]}]},
+			"tags": {"allOf": [{"type": "array"}, {"maxItems": 1}]}
+		},
+		"additionalProperties": false
+	}`
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		raw  string
+		want []string
+	}{
+		{`{"id": 1, "kind": "event", "time": "2024-01-01T00:00:00Z", "user": "a", "tags": ["x"]}`, nil},
+		{`{"id": 0}`, []string{"/id exclusiveMinimum"}},
+		{`{"id": 1.5}`, []string{"/id type"}},
+		{`{"kind": "other"}`, []string{"/kind const"}},
+		{`{"time": "yesterday"}`, []string{"/time format"}},
+		{`{"user": {}}`, []string{"/user anyOf"}},
+		{`{"tags": ["x", "y"]}`, []string{"/tags maxItems"}},
+		{`{"extra": 1, "id": -1}`, []string{"/extra additionalProperties", "/id exclusiveMinimum"}},
+	} {
+		violations, err := s.check([]byte(test.raw))
+		if err != nil || !reflect.DeepEqual(violations, test.want) {
+			t.Errorf("%s: violations %v, %v; want %v", test.raw, violations, err, test.want)
+		}
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	dir := t.TempDir()
+	for i, schema := range []string{
+		`{"type": "objekt"}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"pattern": "("}`,
+		`{"type": `,
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("schema%d.json", i))
+		if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadSchema(path); err == nil {
+			t.Errorf("%s loaded", schema)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Set by `-verify-count`: compare the records scanned in each object with the count its producer recorded
+var VerifyCount bool
+
+// User metadata (`x-amz-meta-record-count`) and sidecar object suffix holding an object's record count
+const (
+	countMetadata = "Record-Count"
+	countSuffix   = ".count"
+)
+
+// The record count the producer of an object recorded, in its metadata or a `{key}.count` sidecar,
+// and where it was found; found is false when there is none
+func expectedCount(sess *session.Session, bucket string, key string) (count int64, source string, found bool, err error) {
+	client := s3.New(sess)
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return 0, "", false, err
+	}
+	if value, ok := head.Metadata[countMetadata]; ok {
+		source = "x-amz-meta-record-count"
+		count, err = strconv.ParseInt(strings.TrimSpace(aws.StringValue(value)), 10, 64)
+		if err != nil {
+			return 0, source, false, fmt.Errorf("invalid %s %q", source, aws.StringValue(value))
+		}
+		return count, source, true, nil
+	}
+
+	source = fmt.Sprintf("s3://%s/%s%s", bucket, key, countSuffix)
+	sidecar, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key + countSuffix)})
+	if isErrCode(err, s3.ErrCodeNoSuchKey) {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, source, false, err
+	}
+	defer sidecar.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(sidecar.Body, 64))
+	if err != nil {
+		return 0, source, false, err
+	}
+	if count, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err != nil {
+		return 0, source, false, fmt.Errorf("invalid count in %s", source)
+	}
+	return count, source, true, nil
+}
+
+// Fail an object whose scanned records differ from its recorded count, e.g. after a truncated upload
+func verifyCount(sess *session.Session, bucket string, key string, scanned int64) error {
+	expected, source, found, err := expectedCount(sess, bucket, key)
+	if err != nil {
+		return fmt.Errorf("unable to read the expected record count: %w", err)
+	}
+	if found && scanned != expected {
+		return fmt.Errorf("record count mismatch: %d records scanned, %d expected by %s", scanned, expected, source)
+	}
+	return nil
+}
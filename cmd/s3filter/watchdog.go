@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"s3filter"
+)
+
+// Transfer limits from `-object-timeout` and `-stall-timeout`
+var (
+	ObjectTimeout time.Duration
+	StallTimeout  time.Duration
+)
+
+// Transfer incidents (timeouts, stalls) reported in the run summary
+var (
+	Incidents    []string
+	incidentsMux sync.Mutex
+)
+
+// Record a transfer incident
+func incident(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	incidentsMux.Lock()
+	defer incidentsMux.Unlock()
+	Incidents = append(Incidents, message)
+	fmt.Fprintln(os.Stderr, message)
+}
+
+// How objects are read: sized by downloadSizing, bounded by `-object-timeout` and `-stall-timeout`,
+// with stalls reported as incidents and the bytes read to the `-progress` tracker
+func transfer() s3filter.Transfer {
+	concurrency, partSize := downloadSizing()
+	t := s3filter.Transfer{
+		Concurrency:  concurrency,
+		PartSize:     partSize,
+		Timeout:      ObjectTimeout,
+		StallTimeout: StallTimeout,
+		Incident:     func(message string) { incident("%s", message) },
+	}
+	if Tracker != nil {
+		t.Begin, t.Progress = Tracker.begin, Tracker.add
+	}
+	return t
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"s3filter"
+)
+
+// Set by `-workers` and `-preserve-order`
+var (
+	Workers       *int
+	PreserveOrder *bool
+)
+
+// Records handed to a worker at a time
+const workerBatch = 256
+
+// Raw record decoded and matched by a worker
+type decoded struct {
+	raw     json.RawMessage
+	offset  int64
+	record  Record
+	matched bool
+	err     error
+	shape   error
+}
+
+type batch struct {
+	items []decoded
+	done  chan struct{}
+}
+
+// Report whether records may be decoded in parallel.
+// Checks, schema validation and context lines depend on seeing every record in turn,
+// and records skipped by `-max-record-bytes` are counted and reported as they are read.
+func decodesInParallel() bool {
+	return *Workers > 1 && len(Checks) == 0 && Contract == nil && Context == nil && *MaxRecord == 0
+}
+
+// Decode and match records on `-workers` goroutines, handling the results on the calling goroutine.
+// Results are handled in input order with `-preserve-order`, and whenever the output depends on it
+// (`-first`, `-last`, `-assume-sorted-by`); otherwise batches are handled as they complete.
+func filterParallel(next func() (json.RawMessage, int64, error)) error {
+	ordered := *PreserveOrder || Pick != nil || *SortedBy != ""
+
+	work := make(chan *batch, *Workers)
+	pending := make(chan *batch, 2**Workers)
+	// the workers are done with the flags before returning, so they can change between objects
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	quit := make(chan struct{})
+	defer close(quit)
+
+	// read raw records in batches; the last item of the last batch carries the read error, if any
+	go func() {
+		defer close(work)
+		defer close(pending)
+		for {
+			b := &batch{done: make(chan struct{})}
+			for len(b.items) < workerBatch {
+				raw, offset, err := next()
+				if err != nil {
+					if err != io.EOF {
+						b.items = append(b.items, decoded{offset: offset, err: err})
+					}
+					break
+				}
+				b.items = append(b.items, decoded{raw: raw, offset: offset})
+			}
+			if len(b.items) == 0 {
+				return
+			}
+			select {
+			case work <- b:
+			case <-quit:
+				return
+			}
+			select {
+			case pending <- b:
+			case <-quit:
+				return
+			}
+			if len(b.items) < workerBatch {
+				return
+			}
+		}
+	}()
+
+	completed := make(chan *batch, *Workers)
+	workers.Add(*Workers)
+	for i := 0; i < *Workers; i++ {
+		go func() {
+			defer workers.Done()
+			// criteria are evaluated over whole batches, a column at a time
+			matcher := &s3filter.Batch{Criteria: criteria()}
+			records := make([]Record, 0, workerBatch)
+			index := make([]int, 0, workerBatch)
+			matched := make([]bool, workerBatch)
+			for {
+				var b *batch
+				select {
+				case b = <-work:
+				case <-quit:
+					return
+				}
+				if b == nil {
+					return
+				}
+				records, index = records[:0], index[:0]
+				for i := range b.items {
+					item := &b.items[i]
+					if item.err == nil {
+						item.shape = s3filter.CheckObject(item.raw)
+					}
+					if item.err == nil && item.shape == nil {
+						if item.record, item.err = s3filter.Decode(item.raw); item.err == nil {
+							records = append(records, item.record)
+							index = append(index, i)
+						}
+					}
+				}
+				matcher.Match(records, matched)
+				for j, i := range index {
+					if item := &b.items[i]; matched[j] {
+						// a record -expr fails on is handled as malformed
+						item.matched, item.shape = refines(item.record)
+					}
+				}
+				close(b.done)
+				if !ordered {
+					select {
+					case completed <- b:
+					case <-quit:
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// records are numbered within the source, as their offsets are
+	first := Scanned
+	for b := range pending {
+		if ordered {
+			<-b.done
+		} else {
+			b = <-completed
+		}
+		for _, item := range b.items {
+			if item.err != nil {
+				return recordError(Scanned-first+1, item.offset, item.err)
+			}
+			Scanned++
+			if item.shape != nil {
+				if err := malformed(Scanned-first, item.offset, item.raw, item.shape); err != nil {
+					return err
+				}
+				continue
+			}
+			stop, err := handle(item.record, nil, item.matched)
+			if err != nil || stop {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Filter src with the given flags, returning the output
+func runFilter(t *testing.T, src string, args ...string) string {
+	t.Helper()
+	return runObjects(t, []string{src}, args...)
+}
+
+// Filter several objects in turn with the given flags, as main does, returning the output
+func runObjects(t *testing.T, objects []string, args ...string) string {
+	t.Helper()
+	Query, Expr, WordRegex, Pick, IDSet, Selected, Access = nil, nil, nil, nil, nil, nil, nil
+	Matched, Scanned = 0, 0
+	processArgs(flag.NewFlagSet("test", flag.ContinueOnError), append([]string{"-history", "off"}, args...))
+	var out bytes.Buffer
+	Output = &out
+	for _, src := range objects {
+		if err := filter(strings.NewReader(src)); err != nil {
+			t.Fatal(err)
+		}
+		if limitReached() || Pick != nil && Pick.settled() {
+			break
+		}
+	}
+	if err := flushPick(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+// Records with ids 1 to n, every tenth of them by user b
+func numbered(n int) string {
+	var src strings.Builder
+	for id := 1; id <= n; id++ {
+		user := "a"
+		if id%10 == 0 {
+			user = "b"
+		}
+		fmt.Fprintf(&src, "{\"id\":%d,\"time\":\"2024-01-01T00:00:00Z\",\"words\":[\"w\"],\"user\":%q}\n", id, user)
+	}
+	return src.String()
+}
+
+func TestWorkersApplyEveryFilter(t *testing.T) {
+	src := numbered(1000)
+	for _, filter := range [][]string{
+		{"-query", "user == 'b'"},
+		{"-expr", `user == "b"`},
+		{"-where", "user=b"},
+	} {
+		sequential := runFilter(t, src, filter...)
+		if got := strings.Count(sequential, "\n"); got != 100 {
+			t.Fatalf("%v: %d records, want 100", filter, got)
+		}
+		parallel := runFilter(t, src, append([]string{"-workers", "4", "-preserve-order"}, filter...)...)
+		if parallel != sequential {
+			t.Errorf("%v with -workers 4 emitted %d records, want the 100 emitted sequentially", filter, strings.Count(parallel, "\n"))
+		}
+	}
+}
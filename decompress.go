@@ -0,0 +1,195 @@
+package s3filter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Limits bound decompression, guarding against decompression bombs; zero fields are unlimited
+type Limits struct {
+	MaxBytes int64   // decompressed size
+	MaxRatio float64 // decompressed size over compressed size
+}
+
+// The expansion ratio is only judged once this much has been decompressed, so tiny objects don't trip it
+const expansionGrace = 1 << 20
+
+// Compression formats recognised by Detect
+const (
+	Plain = ""
+	Gzip  = "gzip"
+	Zstd  = "zstd"
+	Bzip2 = "bzip2"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicBzip2 = []byte("BZh")
+)
+
+// Detect names the compression format of an object from its first bytes.
+// Text that starts like JSON (whitespace, a byte order mark, `{` or `[`) is plain;
+// anything else unrecognised falls back to the key extension (`.gz`, `.zst`, `.bz2`).
+func Detect(head []byte, key string) string {
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return Gzip
+	case bytes.HasPrefix(head, magicZstd):
+		return Zstd
+	case bytes.HasPrefix(head, magicBzip2):
+		return Bzip2
+	case len(head) > 0 && bytes.IndexByte([]byte(" \t\r\n{[\xef\xff\xfe"), head[0]) >= 0:
+		return Plain
+	}
+
+	switch {
+	case strings.HasSuffix(key, ".gz"):
+		return Gzip
+	case strings.HasSuffix(key, ".zst"):
+		return Zstd
+	case strings.HasSuffix(key, ".bz2"):
+		return Bzip2
+	}
+	return Plain
+}
+
+// Decompress opens a decompressing reader for an object, detecting its format with Detect.
+// Plain objects are read as is.
+func Decompress(src io.Reader, key string, limits Limits) (io.Reader, error) {
+	r := bufio.NewReader(src)
+	head, _ := r.Peek(4)
+
+	switch Detect(head, key) {
+	case Gzip:
+		return NewGzipReader(r, limits)
+	case Zstd:
+		return NewZstdReader(r, limits)
+	case Bzip2:
+		return NewBzip2Reader(r, limits), nil
+	}
+	return r, nil
+}
+
+// Inflate decompresses a whole object within the limits, detecting its format like Decompress.
+// Plain objects are returned unchanged.
+func Inflate(data []byte, key string, limits Limits) ([]byte, error) {
+	head := data
+	if len(head) > 4 {
+		head = head[:4]
+	}
+	if Detect(head, key) == Plain {
+		return data, nil
+	}
+
+	reader, err := Decompress(bytes.NewReader(data), key, limits)
+	if err != nil {
+		return nil, err
+	}
+	return readAll(reader)
+}
+
+func readAll(reader io.Reader) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, reader); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewGzipReader opens a gzip stream whose output is checked against the limits as it is read
+func NewGzipReader(src io.Reader, limits Limits) (io.Reader, error) {
+	in := &countingReader{r: src}
+	reader, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	return guard(reader, in, limits), nil
+}
+
+// NewZstdReader opens a zstd stream whose output is checked against the limits as it is read.
+// Frames are decoded synchronously, so an abandoned reader leaves no goroutines behind.
+func NewZstdReader(src io.Reader, limits Limits) (io.Reader, error) {
+	in := &countingReader{r: src}
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if limits.MaxBytes > 0 {
+		options = append(options, zstd.WithDecoderMaxMemory(uint64(limits.MaxBytes)))
+	}
+	reader, err := zstd.NewReader(in, options...)
+	if err != nil {
+		return nil, err
+	}
+	return guard(reader, in, limits), nil
+}
+
+// NewBzip2Reader opens a bzip2 stream whose output is checked against the limits as it is read
+func NewBzip2Reader(src io.Reader, limits Limits) io.Reader {
+	in := &countingReader{r: src}
+	return guard(bzip2.NewReader(in), in, limits)
+}
+
+// Gunzip decompresses a gzip buffer within the limits
+func Gunzip(data []byte, limits Limits) ([]byte, error) {
+	reader, err := NewGzipReader(bytes.NewReader(data), limits)
+	if err != nil {
+		return nil, err
+	}
+	return readAll(reader)
+}
+
+// Check a decompressor's output against the limits, given the reader counting its input
+func guard(reader io.Reader, in *countingReader, limits Limits) io.Reader {
+	if limits.MaxBytes <= 0 && limits.MaxRatio <= 0 {
+		return reader
+	}
+	return &inflateGuard{r: reader, in: in, limits: limits}
+}
+
+// Reader counting the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Reader aborting a decompression that grows past the limits
+type inflateGuard struct {
+	r      io.Reader
+	in     *countingReader
+	out    int64
+	limits Limits
+}
+
+func (g *inflateGuard) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.out += int64(n)
+	if exceeded := g.limits.check(g.out, g.in.n); exceeded != nil {
+		return n, exceeded
+	}
+	return n, err
+}
+
+// Check out bytes decompressed from in compressed bytes against the limits
+func (l Limits) check(out int64, in int64) error {
+	if l.MaxBytes > 0 && out > l.MaxBytes {
+		return fmt.Errorf("decompressed size exceeds %d bytes after %d compressed bytes", l.MaxBytes, in)
+	}
+	if l.MaxRatio > 0 && out > expansionGrace && in > 0 {
+		if ratio := float64(out) / float64(in); ratio > l.MaxRatio {
+			return fmt.Errorf("expansion ratio %.0f:1 exceeds %g after %d compressed bytes", ratio, l.MaxRatio, in)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package s3filter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// NewDownloader creates a downloader tuned for large objects; options are applied after the defaults
+func NewDownloader(sess *session.Session, options ...func(*s3manager.Downloader)) *s3manager.Downloader {
+	return s3manager.NewDownloader(sess, append([]func(*s3manager.Downloader){func(d *s3manager.Downloader) {
+		d.PartSize = 64 * 1024 * 1024 //64MB per part
+		d.Concurrency = 6
+	}}, options...)...)
+}
+
+// Defaults of a Transfer
+const (
+	DefaultConcurrency = 6
+	DefaultPartSize    = 8 << 20
+)
+
+// Attempts made to download an object (or part) whose transfer stalls
+const stallAttempts = 3
+
+// Transfer configures how objects are read. The zero value reads with the defaults and without time limits.
+type Transfer struct {
+	Concurrency  int           // ranged GETs of an object in flight at once, DefaultConcurrency when 0
+	PartSize     int64         // bytes fetched by each ranged GET, DefaultPartSize when 0
+	Timeout      time.Duration // the longest the transfer of one object may take, unlimited when 0
+	StallTimeout time.Duration // reconnect a GET that received no bytes for this long, resuming where it stopped; never when 0
+
+	Begin    func(uri string, size int64) // if set, called as the transfer of an object starts, with the bytes it will read
+	Progress func(n int64)                // if set, called with the bytes of an object as they are read
+	Incident func(message string)         // if set, told of stalls and the reconnections they cause
+}
+
+// Derive the context of one object transfer, bounded by the Timeout
+func (t Transfer) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.Timeout > 0 {
+		return context.WithTimeout(ctx, t.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (t Transfer) incident(format string, args ...interface{}) {
+	if t.Incident != nil {
+		t.Incident(fmt.Sprintf(format, args...))
+	}
+}
+
+// Download reads a whole object into memory with Open
+func Download(ctx context.Context, sess *session.Session, bucket string, key string) ([]byte, error) {
+	return Transfer{}.Download(ctx, sess, bucket, key)
+}
+
+// OpenObject opens an object from offset as a single stream, as Transfer.OpenObject does with the defaults
+func OpenObject(ctx context.Context, sess *session.Session, bucket string, key string, offset int64) (io.ReadCloser, error) {
+	return Transfer{}.OpenObject(ctx, sess, bucket, key, offset)
+}
+
+// Download reads a whole object into memory with Open
+func (t Transfer) Download(ctx context.Context, sess *session.Session, bucket string, key string) ([]byte, error) {
+	stream, err := t.Open(ctx, sess, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var data bytes.Buffer
+	if r, ok := stream.(*rangeReader); ok {
+		data.Grow(int(r.size) + bytes.MinRead)
+	}
+	if _, err = data.ReadFrom(stream); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// Open streams an object with OpenRanges, or with OpenObject through an Object Lambda access point, which serves no ranges
+func (t Transfer) Open(ctx context.Context, sess *session.Session, bucket string, key string) (io.ReadCloser, error) {
+	if IsObjectLambda(bucket) {
+		return t.OpenObject(ctx, sess, bucket, key, 0)
+	}
+	return t.OpenRanges(ctx, sess, bucket, key)
+}
+
+// OpenRanges streams an object as parallel ranged GETs merged back in order, so reading starts with the first part
+// while the following ones download; parts are fetched at most Concurrency ahead of the reader.
+// A stalled GET is resumed from the bytes it had received, and every part is of the version the download started with.
+func (t Transfer) OpenRanges(ctx context.Context, sess *session.Session, bucket string, key string) (io.ReadCloser, error) {
+	client := s3.New(sess)
+	head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	size := aws.Int64Value(head.ContentLength)
+	if t.Begin != nil {
+		t.Begin(fmt.Sprintf("s3://%s/%s", bucket, key), size)
+	}
+
+	concurrency, partSize := t.Concurrency, t.PartSize
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	ctx, cancel := t.context(ctx)
+	r := &rangeReader{
+		transfer: t,
+		client:   client,
+		bucket:   bucket,
+		key:      key,
+		etag:     aws.StringValue(head.ETag),
+		size:     size,
+		ctx:      ctx,
+		cancel:   cancel,
+		parts:    make(chan chan rangePart, concurrency-1), // and the one being read
+	}
+	go r.schedule(size, partSize)
+	return r, nil
+}
+
+// Reader of an object's parts in order, each fetched by its own ranged GET
+type rangeReader struct {
+	transfer    Transfer
+	client      *s3.S3
+	bucket, key string
+	etag        string // every part is of the version the download started with
+	size        int64
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	parts   chan chan rangePart // the parts in order, each delivered once fetched
+	current []byte
+	err     error
+}
+
+type rangePart struct {
+	data []byte
+	err  error
+}
+
+// Start a GET for each part in order, as room in the parts channel frees up
+func (r *rangeReader) schedule(size int64, partSize int64) {
+	defer close(r.parts)
+	for start := int64(0); start < size; start += partSize {
+		slot := make(chan rangePart, 1)
+		select {
+		case r.parts <- slot:
+		case <-r.ctx.Done():
+			return
+		}
+		go func(start, end int64) {
+			data, err := r.fetch(start, end)
+			slot <- rangePart{data: data, err: err}
+		}(start, min(start+partSize, size))
+	}
+}
+
+// Fetch the bytes from start up to end; a stalled GET is cancelled and resumed from the bytes it had received
+func (r *rangeReader) fetch(start, end int64) ([]byte, error) {
+	data := make([]byte, end-start)
+	got, stalls := 0, 0
+	for {
+		n, err := r.fetchOnce(start+int64(got), data[got:])
+		got += n
+		if n > 0 {
+			stalls = 0
+		}
+		if err != ErrStalled {
+			if err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+		if stalls++; stalls == stallAttempts {
+			r.transfer.incident("Download of bytes %d-%d of s3://%s/%s stalled for %v at byte %d, giving up after %d attempts", start, end-1, r.bucket, r.key, r.transfer.StallTimeout, start+int64(got), stalls)
+			return nil, err
+		}
+		r.transfer.incident("Download of bytes %d-%d of s3://%s/%s stalled for %v at byte %d, reconnecting (attempt %d)", start, end-1, r.bucket, r.key, r.transfer.StallTimeout, start+int64(got), stalls+1)
+	}
+}
+
+// Fill data from start with one ranged GET
+func (r *rangeReader) fetchOnce(start int64, data []byte) (int, error) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	wd := watch(r.transfer.StallTimeout, cancel)
+	object, err := r.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(r.bucket),
+		Key:     aws.String(r.key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, start+int64(len(data))-1)),
+		IfMatch: aws.String(r.etag),
+	})
+	if err != nil {
+		cancel()
+		return 0, wd.stop(err)
+	}
+	body := &watchedReader{r: object.Body, wd: wd, cancel: cancel}
+	defer body.Close()
+	return io.ReadFull(body, data)
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		slot, ok := <-r.parts
+		if !ok {
+			if err := r.ctx.Err(); err != nil {
+				// the object timed out between parts
+				r.err = err
+				continue
+			}
+			return 0, io.EOF
+		}
+		part := <-slot
+		r.current, r.err = part.data, part.err
+	}
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	if r.transfer.Progress != nil {
+		r.transfer.Progress(int64(n))
+	}
+	return n, nil
+}
+
+// Cancel the GETs still in flight
+func (r *rangeReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// OpenObject opens an object from offset as a single stream, so reading can stop (and the transfer be aborted) at any point.
+// A connection that stalls is replaced by one resuming where it stopped, of the same version of the object.
+func (t Transfer) OpenObject(ctx context.Context, sess *session.Session, bucket string, key string, offset int64) (io.ReadCloser, error) {
+	ctx, cancel := t.context(ctx)
+	r := &objectStream{transfer: t, client: s3.New(sess), bucket: bucket, key: key, offset: offset, ctx: ctx, cancel: cancel}
+	if err := r.connect(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Stream of an object within the transfer's Timeout, each connection watched for its StallTimeout
+type objectStream struct {
+	transfer    Transfer
+	client      *s3.S3
+	bucket, key string
+	offset      int64  // of the next byte
+	etag        string // of the first response, so a resumed read fails rather than mixing versions
+	ctx         context.Context
+	cancel      context.CancelFunc
+	body        io.ReadCloser
+	stalls      int // in a row, without a byte read since
+}
+
+// Open a connection from the offset, retrying connections that stall
+func (r *objectStream) connect() error {
+	for {
+		err := r.open()
+		if err != ErrStalled || !r.retry() {
+			return err
+		}
+	}
+}
+
+func (r *objectStream) open() error {
+	ctx, cancel := context.WithCancel(r.ctx)
+	wd := watch(r.transfer.StallTimeout, cancel)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.key),
+	}
+	if r.offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", r.offset))
+	}
+	if r.etag != "" {
+		input.IfMatch = aws.String(r.etag)
+	}
+	object, err := r.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		cancel()
+		return wd.stop(err)
+	}
+	if r.etag == "" {
+		r.etag = aws.StringValue(object.ETag)
+		if r.transfer.Begin != nil {
+			// the bytes from the offset, which is all the stream reads
+			r.transfer.Begin(fmt.Sprintf("s3://%s/%s", r.bucket, r.key), aws.Int64Value(object.ContentLength))
+		}
+	}
+	// the clock only runs while the stream is read
+	wd.pause()
+	r.body = &watchedReader{r: object.Body, wd: wd, cancel: cancel}
+	return nil
+}
+
+// Count a stall, reporting whether to reconnect
+func (r *objectStream) retry() bool {
+	r.stalls++
+	switch {
+	case r.ctx.Err() != nil:
+		return false
+	case r.offset > 0 && IsObjectLambda(r.bucket):
+		r.transfer.incident("Download of s3://%s/%s stalled for %v at byte %d, which Object Lambda access points can't resume", r.bucket, r.key, r.transfer.StallTimeout, r.offset)
+		return false
+	case r.stalls == stallAttempts:
+		r.transfer.incident("Download of s3://%s/%s stalled for %v at byte %d, giving up after %d attempts", r.bucket, r.key, r.transfer.StallTimeout, r.offset, r.stalls)
+		return false
+	}
+	r.transfer.incident("Download of s3://%s/%s stalled for %v at byte %d, reconnecting (attempt %d)", r.bucket, r.key, r.transfer.StallTimeout, r.offset, r.stalls+1)
+	return true
+}
+
+func (r *objectStream) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if n > 0 {
+		r.stalls = 0
+	}
+	if r.transfer.Progress != nil {
+		r.transfer.Progress(int64(n))
+	}
+	if err != ErrStalled || !r.retry() {
+		return n, err
+	}
+	r.body.Close()
+	if err = r.connect(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (r *objectStream) Close() error {
+	r.cancel()
+	return r.body.Close()
+}
+
+// ListObjects lists every object under prefix, following ListObjectsV2 pagination
+func ListObjects(client *s3.S3, bucket string, prefix string) ([]*s3.Object, error) {
+	var objects []*s3.Object
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			// skip folder placeholders
+			if !strings.HasSuffix(aws.StringValue(object.Key), "/") {
+				objects = append(objects, object)
+			}
+		}
+		return true
+	})
+	return objects, err
+}
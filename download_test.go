@@ -0,0 +1,174 @@
+package s3filter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// An S3 endpoint serving one object whose first GET stalls after half of it
+func stallingServer(t *testing.T, object string) (*session.Session, *int32) {
+	var gets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, end := 0, len(object)-1
+		if spec := r.Header.Get("Range"); spec != "" {
+			fmt.Sscanf(spec, "bytes=%d-%d", &offset, &end)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end, len(object)))
+			w.Header().Set("Content-Length", fmt.Sprint(end+1-offset))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", fmt.Sprint(len(object)))
+		}
+		if r.Method == http.MethodHead {
+			return
+		}
+		if atomic.AddInt32(&gets, 1) == 1 {
+			io.WriteString(w, object[:len(object)/2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, object[offset:end+1])
+	}))
+	t.Cleanup(server.Close)
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess, &gets
+}
+
+func TestOpenObjectResumesStall(t *testing.T) {
+	object := strings.Repeat("{\"id\":1}\n", 1000)
+	sess, gets := stallingServer(t, object)
+
+	var incidents []string
+	var begun, read int64
+	transfer := Transfer{
+		StallTimeout: 200 * time.Millisecond,
+		Begin:        func(uri string, size int64) { begun = size },
+		Progress:     func(n int64) { read += n },
+		Incident:     func(message string) { incidents = append(incidents, message) },
+	}
+	stream, err := transfer.OpenObject(context.Background(), sess, "bucket", "key", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	got, err := io.ReadAll(stream)
+	if err != nil || string(got) != object {
+		t.Fatalf("read %d of %d bytes, %v", len(got), len(object), err)
+	}
+	if *gets != 2 {
+		t.Errorf("%d GETs, want the stalled one and one resuming it", *gets)
+	}
+	if len(incidents) != 1 || !strings.Contains(incidents[0], "reconnecting (attempt 2)") {
+		t.Errorf("incidents %q, want the reconnection", incidents)
+	}
+	if begun != int64(len(object)) || read != int64(len(object)) {
+		t.Errorf("began with %d and read %d bytes, want %d", begun, read, len(object))
+	}
+
+	// from an offset, progress covers the bytes from there
+	begun, read = 0, 0
+	stream, err = transfer.OpenObject(context.Background(), sess, "bucket", "key", 900)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if got, err = io.ReadAll(stream); err != nil || string(got) != object[900:] {
+		t.Fatalf("read %d of %d bytes, %v", len(got), len(object)-900, err)
+	}
+	if begun != int64(len(object)-900) || read != begun {
+		t.Errorf("began with %d and read %d bytes from offset 900, want %d", begun, read, len(object)-900)
+	}
+}
+
+func TestSlowConsumerIsNoStall(t *testing.T) {
+	timeout := 100 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader, err := Transfer{StallTimeout: timeout}.Watch(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("abc")), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(2 * timeout)
+		if _, err := reader.Read(make([]byte, 1)); err != nil || ctx.Err() != nil {
+			t.Fatalf("read %d after a pause: %v, %v", i, err, ctx.Err())
+		}
+	}
+}
+
+func TestWatchStalls(t *testing.T) {
+	reader, err := Transfer{StallTimeout: 100 * time.Millisecond}.Watch(context.Background(), func(ctx context.Context) (io.ReadCloser, error) {
+		r, w := io.Pipe()
+		go func() {
+			<-ctx.Done()
+			w.CloseWithError(ctx.Err())
+		}()
+		return r, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err = reader.Read(make([]byte, 1)); err != ErrStalled {
+		t.Errorf("got %v, want ErrStalled", err)
+	}
+}
+
+func TestDownloadResumesStalledRange(t *testing.T) {
+	object := strings.Repeat("{\"id\":1}\n", 1000)
+	sess, gets := stallingServer(t, object)
+
+	var begun, read int64
+	transfer := Transfer{
+		StallTimeout: 200 * time.Millisecond,
+		Begin:        func(uri string, size int64) { begun = size },
+		Progress:     func(n int64) { read += n },
+	}
+	got, err := transfer.Download(context.Background(), sess, "bucket", "key")
+	if err != nil || string(got) != object {
+		t.Fatalf("downloaded %d of %d bytes, %v", len(got), len(object), err)
+	}
+	if *gets != 2 {
+		t.Errorf("%d GETs, want the stalled one and one resuming it", *gets)
+	}
+	if begun != int64(len(object)) || read != int64(len(object)) {
+		t.Errorf("began with %d and read %d bytes, want %d", begun, read, len(object))
+	}
+}
+
+func TestDownloadInParts(t *testing.T) {
+	object := strings.Repeat("{\"id\":1}\n", 1000)
+	sess, _ := stallingServer(t, object)
+
+	// the first GET stalls until the timeout ends the download
+	_, err := Transfer{PartSize: 1000, Timeout: 300 * time.Millisecond}.Download(context.Background(), sess, "bucket", "key")
+	if err == nil {
+		t.Fatal("downloaded despite the stalled part")
+	}
+	got, err := Transfer{PartSize: 1000, Concurrency: 3}.Download(context.Background(), sess, "bucket", "key")
+	if err != nil || string(got) != object {
+		t.Fatalf("downloaded %d of %d bytes, %v", len(got), len(object), err)
+	}
+}
@@ -0,0 +1,119 @@
+package s3filter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// DecodeText wraps src so it yields UTF-8 without a byte order mark.
+// encoding is one of `auto`, `utf-8`, `utf-16le` or `utf-16be`; `auto` detects UTF-16 by its BOM.
+// CRLF line endings need no treatment since the decoder skips `\r` as whitespace.
+func DecodeText(src io.Reader, encoding string) (io.Reader, error) {
+	r := bufio.NewReader(src)
+	head, _ := r.Peek(3)
+
+	switch encoding {
+	case "auto":
+		switch {
+		case bytes.HasPrefix(head, bomUTF16LE):
+			r.Discard(2)
+			return &utf16Reader{r: r, order: binary.LittleEndian}, nil
+		case bytes.HasPrefix(head, bomUTF16BE):
+			r.Discard(2)
+			return &utf16Reader{r: r, order: binary.BigEndian}, nil
+		}
+		fallthrough
+	case "utf-8":
+		if bytes.HasPrefix(head, bomUTF8) {
+			r.Discard(3)
+		}
+		return r, nil
+	case "utf-16le":
+		if bytes.HasPrefix(head, bomUTF16LE) {
+			r.Discard(2)
+		}
+		return &utf16Reader{r: r, order: binary.LittleEndian}, nil
+	case "utf-16be":
+		if bytes.HasPrefix(head, bomUTF16BE) {
+			r.Discard(2)
+		}
+		return &utf16Reader{r: r, order: binary.BigEndian}, nil
+	}
+	return nil, fmt.Errorf("unsupported input encoding %q", encoding)
+}
+
+// Reader transcoding UTF-16 code units in the given byte order to UTF-8
+type utf16Reader struct {
+	r       *bufio.Reader
+	order   binary.ByteOrder
+	buf     []byte
+	err     error
+	held    uint16 // a code unit read ahead, after an unpaired surrogate
+	holding bool
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.buf) < len(p) && u.err == nil {
+		var r rune
+		if r, u.err = u.char(); u.err == nil {
+			u.buf = utf8.AppendRune(u.buf, r)
+		}
+	}
+	// the characters before an error are returned first
+	if len(u.buf) == 0 {
+		return 0, u.err
+	}
+	n := copy(p, u.buf)
+	u.buf = u.buf[n:]
+	return n, nil
+}
+
+// Read one character; an unpaired surrogate becomes U+FFFD
+func (u *utf16Reader) char() (rune, error) {
+	unit, err := u.unit()
+	if err != nil {
+		return 0, err
+	}
+	r := rune(unit)
+	if !utf16.IsSurrogate(r) {
+		return r, nil
+	}
+	low, err := u.unit()
+	if err == io.EOF {
+		return utf8.RuneError, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if r = utf16.DecodeRune(r, rune(low)); r == utf8.RuneError {
+		u.held, u.holding = low, true
+	}
+	return r, nil
+}
+
+// Read one code unit
+func (u *utf16Reader) unit() (uint16, error) {
+	if u.holding {
+		u.holding = false
+		return u.held, nil
+	}
+	var b [2]byte
+	if _, err := io.ReadFull(u.r, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("truncated UTF-16 input: odd number of bytes")
+		}
+		return 0, err
+	}
+	return u.order.Uint16(b[:]), nil
+}
@@ -0,0 +1,81 @@
+package s3filter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+// Encode text as UTF-16 code units in either byte order
+func utf16Bytes(text string, bigEndian bool, units ...uint16) []byte {
+	var b []byte
+	for _, unit := range append(utf16.Encode([]rune(text)), units...) {
+		if bigEndian {
+			b = append(b, byte(unit>>8), byte(unit))
+		} else {
+			b = append(b, byte(unit), byte(unit>>8))
+		}
+	}
+	return b
+}
+
+func TestDecodeText(t *testing.T) {
+	const text = "{\"w\":\"é😀\"}\r\n"
+	for _, test := range []struct {
+		name     string
+		src      []byte
+		encoding string
+		want     string
+		fails    bool
+	}{
+		{"utf-8", []byte(text), "auto", text, false},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, text...), "auto", text, false},
+		{"utf-8 bom given", append([]byte{0xEF, 0xBB, 0xBF}, text...), "utf-8", text, false},
+		{"utf-16le bom", append([]byte{0xFF, 0xFE}, utf16Bytes(text, false)...), "auto", text, false},
+		{"utf-16be bom", append([]byte{0xFE, 0xFF}, utf16Bytes(text, true)...), "auto", text, false},
+		{"utf-16le given", utf16Bytes(text, false), "utf-16le", text, false},
+		{"utf-16be given", utf16Bytes(text, true), "utf-16be", text, false},
+		{"utf-16le bom given", append([]byte{0xFF, 0xFE}, utf16Bytes(text, false)...), "utf-16le", text, false},
+		// without a BOM, auto reads UTF-8
+		{"utf-16le without bom", utf16Bytes("a", false), "auto", "a\x00", false},
+		{"empty", nil, "auto", "", false},
+		{"empty utf-16", nil, "utf-16le", "", false},
+
+		// unpaired surrogates become U+FFFD, keeping the unit after them
+		{"lone high surrogate", utf16Bytes("a", false, 0xD83D, 'b'), "utf-16le", "a�b", false},
+		{"lone low surrogate", utf16Bytes("a", false, 0xDE00, 0xD83D, 0xDE00), "utf-16le", "a�😀", false},
+		{"high surrogate at the end", utf16Bytes("a", true, 0xD83D), "utf-16be", "a�", false},
+
+		{"odd length", append(utf16Bytes("ab", false), 'c'), "utf-16le", "ab", true},
+		{"unknown encoding", []byte(text), "latin-1", "", true},
+	} {
+		r, err := DecodeText(bytes.NewReader(test.src), test.encoding)
+		var got []byte
+		if err == nil {
+			// one byte at a time, so characters span reads
+			got, err = io.ReadAll(iotest.OneByteReader(r))
+		}
+		if string(got) != test.want || (err != nil) != test.fails {
+			t.Errorf("%s: got %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestDecodeTextRecords(t *testing.T) {
+	src := `{"id":1,"words":["été"]}` + "\r\n" + `{"id":2,"words":["x"]}` + "\r\n"
+	text, err := DecodeText(bytes.NewReader(append([]byte{0xFE, 0xFF}, utf16Bytes(src, true)...)), "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	err = Filter(text, Criteria{Word: "été"}, func(r Record) error {
+		found = append(found, string(r.Raw))
+		return nil
+	})
+	if want := `{"id":1,"words":["été"]}`; err != nil || strings.Join(found, "\n") != want {
+		t.Errorf("got %q, %v, want %q", found, err, want)
+	}
+}
@@ -1,10 +1,24 @@
 module s3filter
 
-go 1.19
+go 1.24.0
 
 require (
 	github.com/aws/aws-sdk-go v1.44.185
-	golang.org/x/exp v0.0.0-20230118134722-a68e582fa157
+	github.com/google/cel-go v0.26.1
+	github.com/google/pprof v0.0.0-20260115054156-294ebfa9ad83
+	github.com/jmespath/go-jmespath v0.4.0
+	github.com/klauspost/compress v1.18.0
+	github.com/santhosh-tekuri/jsonschema/v6 v6.0.2
+	golang.org/x/exp v0.0.0-20230515195305-f3d0a9c9a5cc
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/jmespath/go-jmespath v0.4.0 // indirect
+require (
+	cel.dev/expr v0.24.0 // indirect
+	github.com/antlr4-go/antlr/v4 v4.13.0 // indirect
+	github.com/stoewer/go-strcase v1.2.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240826202546-f6391c0de4c7 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240826202546-f6391c0de4c7 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
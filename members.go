@@ -0,0 +1,177 @@
+package s3filter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// A gzip member decompressed ahead of being read
+type member struct {
+	start int
+	end   int // offset just past the member's trailer
+	data  []byte
+	err   error
+}
+
+// GunzipMembers decompresses a multi-member gzip buffer with up to workers members inflated concurrently,
+// reading their output back in order. Members are found by their header bytes; a match inside compressed data
+// fails to decompress (or to end where a member starts) and is skipped, and a buffer it cannot split is inflated in one stream.
+// Closing the reader before the end stops the decompression.
+func GunzipMembers(data []byte, workers int, limits Limits) (io.ReadCloser, error) {
+	if workers < 2 || len(memberStarts(data)) < 2 {
+		reader, err := NewGzipReader(bytes.NewReader(data), limits)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	}
+	return GunzipStream(bytes.NewReader(data), workers, len(data), limits), nil
+}
+
+// GunzipStream decompresses a gzip stream like GunzipMembers, splitting members out of a look-ahead window
+// of at most window compressed bytes so memory stays bounded. From a member that doesn't end within the window,
+// which includes the only member of a single-member stream, the rest is inflated in one stream.
+// Errors, including a stream that is not gzip, are returned by Read; closing the reader stops the decompression.
+func GunzipStream(src io.Reader, workers int, window int, limits Limits) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(gunzipWindows(src, writer, workers, max(window, 1), limits))
+	}()
+	return reader
+}
+
+// Decompress src into w a window at a time, finishing in one stream once a window can't be split
+func gunzipWindows(src io.Reader, w io.Writer, workers int, window int, limits Limits) error {
+	buf := make([]byte, 0, window)
+	var in, out int64
+	eof := false
+	for {
+		for !eof && len(buf) < window {
+			n, err := src.Read(buf[len(buf):window])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if eof && len(buf) == 0 && in > 0 {
+			return nil
+		}
+		pos, err := inflateMembers(buf, in, &out, workers, limits, w)
+		if err != nil {
+			return err
+		}
+		if pos == 0 {
+			rest := limits
+			if rest.MaxBytes > 0 {
+				rest.MaxBytes = max(rest.MaxBytes-out, 1)
+			}
+			tail, err := NewGzipReader(io.MultiReader(bytes.NewReader(buf), src), rest)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, tail)
+			return err
+		}
+		in += int64(pos)
+		buf = buf[:copy(buf, buf[pos:])]
+	}
+}
+
+// Inflate the members of data concurrently, writing their output to w in order until one fails or data ends mid-member.
+// It returns the offset just past the last member written; in is the compressed size before data and out the
+// decompressed size so far, for the limits.
+func inflateMembers(data []byte, in int64, out *int64, workers int, limits Limits, w io.Writer) (int, error) {
+	starts := memberStarts(data)
+	results := make([]chan member, len(starts))
+	for i := range results {
+		results[i] = make(chan member, 1)
+	}
+	// tokens bound the members decompressed but not yet written
+	tokens := make(chan struct{}, max(workers, 1))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i, start := range starts {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i, start int) {
+				results[i] <- inflateMember(data, start, limits)
+			}(i, start)
+		}
+	}()
+
+	pos := 0
+	for i, start := range starts {
+		m := <-results[i]
+		<-tokens
+		if start != pos {
+			// inside a member already written
+			continue
+		}
+		if m.err != nil {
+			break
+		}
+		*out += int64(len(m.data))
+		if err := limits.check(*out, in+int64(m.end)); err != nil {
+			return pos, err
+		}
+		if _, err := w.Write(m.data); err != nil {
+			// the reader was closed
+			return pos, err
+		}
+		pos = m.end
+	}
+	return pos, nil
+}
+
+// Offsets of the bytes that look like a gzip member header: magic, deflate method and no reserved flags
+func memberStarts(data []byte) []int {
+	var starts []int
+	for i := 0; i+10 <= len(data); i++ {
+		j := bytes.Index(data[i:], magicGzip)
+		if j < 0 {
+			break
+		}
+		i += j
+		if i+10 <= len(data) && data[i+2] == 8 && data[i+3]&0xe0 == 0 {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// Decompress the single member starting at start
+func inflateMember(data []byte, start int, limits Limits) member {
+	m := member{start: start}
+	src := bytes.NewReader(data[start:])
+	reader, err := gzip.NewReader(src)
+	if err != nil {
+		m.err = err
+		return m
+	}
+	reader.Multistream(false)
+
+	var out io.Reader = reader
+	if limits.MaxBytes > 0 {
+		out = io.LimitReader(reader, limits.MaxBytes+1)
+	}
+	buf := new(bytes.Buffer)
+	if _, m.err = io.Copy(buf, out); m.err != nil {
+		return m
+	}
+	if limits.MaxBytes > 0 && int64(buf.Len()) > limits.MaxBytes {
+		m.err = fmt.Errorf("decompressed size of member at %d exceeds %d bytes", start, limits.MaxBytes)
+		return m
+	}
+	m.data = buf.Bytes()
+	// bytes.Reader is an io.ByteReader, so nothing past the trailer has been read
+	m.end = len(data) - src.Len()
+	return m
+}
@@ -0,0 +1,78 @@
+package s3filter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// A gzip object of n members, each holding 100 lines
+func multiMember(t *testing.T, n int) ([]byte, string) {
+	var data bytes.Buffer
+	var text bytes.Buffer
+	for i := 0; i < n; i++ {
+		gz := gzip.NewWriter(&data)
+		for j := 0; j < 100; j++ {
+			line := fmt.Sprintf("{\"id\":%d}\n", i*100+j)
+			text.WriteString(line)
+			gz.Write([]byte(line))
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return data.Bytes(), text.String()
+}
+
+func TestGunzipMembers(t *testing.T) {
+	data, text := multiMember(t, 50)
+	reader, err := GunzipMembers(data, 4, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil || string(got) != text {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+}
+
+func TestGunzipMembersClose(t *testing.T) {
+	data, _ := multiMember(t, 50)
+	before := runtime.NumGoroutine()
+	reader, err := GunzipMembers(data, 4, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reader.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running after Close, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGunzipStream(t *testing.T) {
+	data, text := multiMember(t, 50)
+	for _, window := range []int{100, 1000, 5000, len(data)} {
+		got, err := io.ReadAll(GunzipStream(bytes.NewReader(data), 4, window, Limits{}))
+		if err != nil || string(got) != text {
+			t.Errorf("window %d: read %d bytes, %v", window, len(got), err)
+		}
+	}
+	single, text := multiMember(t, 1)
+	got, err := io.ReadAll(GunzipStream(bytes.NewReader(single), 4, 16, Limits{}))
+	if err != nil || string(got) != text {
+		t.Errorf("single member: read %d bytes, %v", len(got), err)
+	}
+	if _, err := io.ReadAll(GunzipStream(bytes.NewReader([]byte("{}\n")), 4, 16, Limits{})); err == nil {
+		t.Error("plain text decompressed")
+	}
+}
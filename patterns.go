@@ -0,0 +1,156 @@
+package s3filter
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Matcher reports whether a word matches, as *regexp.Regexp and *PatternSet do
+type Matcher interface {
+	MatchString(s string) bool
+}
+
+// PatternSet matches words against many regular expressions in one pass.
+// Patterns that are plain literals are found together with an Aho–Corasick automaton
+// (`^literal$` ones by a lookup), and the others are combined into one alternation.
+type PatternSet struct {
+	exact    map[string]bool
+	literals *automaton
+	rest     *regexp.Regexp
+}
+
+// CompilePatterns compiles regular expressions into a set matching a word when any of them does
+func CompilePatterns(patterns []string) (*PatternSet, error) {
+	set := &PatternSet{exact: map[string]bool{}}
+	var literals, rest []string
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+		literal, exact := literalPattern(pattern)
+		switch {
+		case exact:
+			set.exact[literal] = true
+		case literal != "":
+			literals = append(literals, literal)
+		default:
+			rest = append(rest, "(?:"+pattern+")")
+		}
+	}
+
+	if len(literals) > 0 {
+		set.literals = newAutomaton(literals)
+	}
+	if len(rest) > 0 {
+		combined, err := regexp.Compile(strings.Join(rest, "|"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to combine the patterns: %v", err)
+		}
+		set.rest = combined
+	}
+	return set, nil
+}
+
+// MatchString reports whether the word matches any pattern of the set
+func (s *PatternSet) MatchString(word string) bool {
+	if s.exact[word] {
+		return true
+	}
+	if s.literals != nil && s.literals.contains(word) {
+		return true
+	}
+	return s.rest != nil && s.rest.MatchString(word)
+}
+
+// The text a pattern matches when it is a case-sensitive literal, and whether it is anchored at both ends
+func literalPattern(pattern string) (literal string, exact bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	re = re.Simplify()
+	text := func(re *syntax.Regexp) (string, bool) {
+		if re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 {
+			return "", false
+		}
+		return string(re.Rune), true
+	}
+
+	if literal, ok := text(re); ok {
+		return literal, false
+	}
+	if re.Op == syntax.OpConcat && len(re.Sub) == 3 && re.Sub[0].Op == syntax.OpBeginText && re.Sub[2].Op == syntax.OpEndText {
+		if literal, ok := text(re.Sub[1]); ok {
+			return literal, true
+		}
+	}
+	return "", false
+}
+
+// Aho–Corasick automaton finding whether a text contains any of a set of strings
+type automaton struct {
+	next [](map[byte]int32) // trie edges of each node
+	fail []int32            // longest proper suffix of each node that is also in the trie
+	out  []bool             // whether a string ends at the node or one of its suffixes
+}
+
+func newAutomaton(literals []string) *automaton {
+	a := &automaton{next: []map[byte]int32{{}}, fail: []int32{0}, out: []bool{false}}
+	for _, literal := range literals {
+		node := int32(0)
+		for i := 0; i < len(literal); i++ {
+			child, ok := a.next[node][literal[i]]
+			if !ok {
+				child = int32(len(a.next))
+				a.next = append(a.next, map[byte]int32{})
+				a.fail = append(a.fail, 0)
+				a.out = append(a.out, false)
+				a.next[node][literal[i]] = child
+			}
+			node = child
+		}
+		a.out[node] = true
+	}
+
+	// breadth first, so the failure link of a node's parent is set before the node's
+	queue := []int32{}
+	for _, child := range a.next[0] {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for c, child := range a.next[node] {
+			fail := a.fail[node]
+			for fail != 0 && a.next[fail][c] == 0 {
+				fail = a.fail[fail]
+			}
+			if target, ok := a.next[fail][c]; ok && target != child {
+				a.fail[child] = target
+			}
+			a.out[child] = a.out[child] || a.out[a.fail[child]]
+			queue = append(queue, child)
+		}
+	}
+	return a
+}
+
+func (a *automaton) contains(text string) bool {
+	if a.out[0] {
+		return true
+	}
+	node := int32(0)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		for node != 0 && a.next[node][c] == 0 {
+			node = a.fail[node]
+		}
+		node = a.next[node][c]
+		if a.out[node] {
+			return true
+		}
+	}
+	return false
+}
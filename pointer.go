@@ -0,0 +1,242 @@
+package s3filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errTruncated = errors.New("unexpected end of JSON value")
+
+// ParsePointer splits a JSON pointer (RFC 6901), e.g. `/user/tags/0`, into the names of its fields
+func ParsePointer(pointer string) []string {
+	path := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, name := range path {
+		path[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+	}
+	return path
+}
+
+// Pointers is a set of field paths extracted from documents in one pass, descending only into the fields
+// on a path and skipping every other value without decoding it. It is safe for concurrent use.
+type Pointers struct {
+	root  *pointerNode
+	count int
+}
+
+type pointerNode struct {
+	fields   map[string]*pointerNode // object members on a path
+	elements map[int]*pointerNode    // array elements on a path, by index
+	paths    []int                   // the paths ending here
+	within   []int                   // the paths ending here or under here
+}
+
+// NewPointers makes the set of the paths, each a list of field names (or array indexes) from the top of the document
+func NewPointers(paths [][]string) *Pointers {
+	set := &Pointers{root: &pointerNode{}, count: len(paths)}
+	for i, path := range paths {
+		node := set.root
+		node.within = append(node.within, i)
+		for _, name := range path {
+			if node.fields == nil {
+				node.fields = map[string]*pointerNode{}
+			}
+			child, ok := node.fields[name]
+			if !ok {
+				child = &pointerNode{}
+				node.fields[name] = child
+				if index, err := strconv.Atoi(name); err == nil && index >= 0 {
+					if node.elements == nil {
+						node.elements = map[int]*pointerNode{}
+					}
+					node.elements[index] = child
+				}
+			}
+			node = child
+			node.within = append(node.within, i)
+		}
+		node.paths = append(node.paths, i)
+	}
+	return set
+}
+
+// Extract finds the raw value at each path of the set in a JSON document, nil where there is none.
+// As when decoding into a map, the last of repeated members wins.
+func (s *Pointers) Extract(doc []byte) ([][]byte, error) {
+	found := make([][]byte, s.count)
+	scan := &jsonScanner{data: doc}
+	if err := scan.walk(s.root, found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// Reads a well-formed JSON document; syntax is checked by the decoder beforehand
+type jsonScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *jsonScanner) skipSpace() error {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\r', '\n':
+			s.pos++
+		default:
+			return nil
+		}
+	}
+	return errTruncated
+}
+
+// Read the value at the scanner, recording it for the paths ending at node and descending into its members on them
+func (s *jsonScanner) walk(node *pointerNode, found [][]byte) error {
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	// a repeated member replaces what an earlier one held
+	for _, path := range node.within {
+		found[path] = nil
+	}
+	start := s.pos
+	var err error
+	switch {
+	case s.data[s.pos] == '{' && node.fields != nil:
+		err = s.walkObject(node, found)
+	case s.data[s.pos] == '[' && node.elements != nil:
+		err = s.walkArray(node, found)
+	default:
+		err = s.skipValue()
+	}
+	if err != nil {
+		return err
+	}
+	for _, path := range node.paths {
+		found[path] = s.data[start:s.pos]
+	}
+	return nil
+}
+
+func (s *jsonScanner) walkObject(node *pointerNode, found [][]byte) error {
+	s.pos++
+	for {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if s.data[s.pos] == '}' {
+			s.pos++
+			return nil
+		}
+		if s.data[s.pos] == ',' {
+			s.pos++
+			continue
+		}
+
+		start := s.pos
+		if err := s.skipString(); err != nil {
+			return err
+		}
+		key := s.data[start+1 : s.pos-1]
+		child := node.fields[string(key)]
+		if child == nil && bytes.IndexByte(key, '\\') >= 0 {
+			var name string
+			if json.Unmarshal(s.data[start:s.pos], &name) == nil {
+				child = node.fields[name]
+			}
+		}
+
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		s.pos++ // ':'
+		if child == nil {
+			if err := s.skipSpace(); err != nil {
+				return err
+			}
+			if err := s.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.walk(child, found); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *jsonScanner) walkArray(node *pointerNode, found [][]byte) error {
+	s.pos++
+	for index := 0; ; {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		switch s.data[s.pos] {
+		case ']':
+			s.pos++
+			return nil
+		case ',':
+			s.pos++
+			index++
+			continue
+		}
+		if child := node.elements[index]; child != nil {
+			if err := s.walk(child, found); err != nil {
+				return err
+			}
+		} else if err := s.skipValue(); err != nil {
+			return err
+		}
+	}
+}
+
+// Move past the string at the scanner, including its quotes
+func (s *jsonScanner) skipString() error {
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		switch s.data[s.pos] {
+		case '\\':
+			s.pos++
+		case '"':
+			s.pos++
+			return nil
+		}
+	}
+	return errTruncated
+}
+
+// Move past the value at the scanner without decoding it
+func (s *jsonScanner) skipValue() error {
+	switch s.data[s.pos] {
+	case '"':
+		return s.skipString()
+	case '{', '[':
+		depth := 0
+		for ; s.pos < len(s.data); s.pos++ {
+			switch s.data[s.pos] {
+			case '"':
+				if err := s.skipString(); err != nil {
+					return err
+				}
+				s.pos--
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					s.pos++
+					return nil
+				}
+			}
+		}
+		return errTruncated
+	}
+	// a number, `true`, `false` or `null`
+	for ; s.pos < len(s.data); s.pos++ {
+		switch s.data[s.pos] {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			return nil
+		}
+	}
+	return nil
+}
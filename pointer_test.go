@@ -0,0 +1,49 @@
+package s3filter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	for pointer, want := range map[string]string{
+		"/user/country": "[user country]",
+		"/tags/0":       "[tags 0]",
+		"/a~1b/c~0d":    "[a/b c~d]",
+		"/":             "[]",
+	} {
+		if got := fmt.Sprint(ParsePointer(pointer)); got != want {
+			t.Errorf("%s: got %s, want %s", pointer, got, want)
+		}
+	}
+}
+
+func TestPointersExtract(t *testing.T) {
+	doc := []byte(`{"id": 1, "user": {"name": "a \"b\"", "tags": ["x", {"k": [1, 2]}]}, "skip": {"user": 2}, "id": 3, "text": "}]"}`)
+	pointers := NewPointers([][]string{
+		{"id"},
+		{"user", "name"},
+		{"user", "tags", "1", "k"},
+		{"user", "tags", "0"},
+		{"user", "tags", "5"},
+		{"missing"},
+		{"user"},
+		{"text"},
+	})
+	found, err := pointers.Extract(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`3`, `"a \"b\""`, `[1, 2]`, `"x"`, ``, ``, `{"name": "a \"b\"", "tags": ["x", {"k": [1, 2]}]}`, `"}]"`}
+	for i, value := range found {
+		if string(value) != want[i] || (value == nil) != (want[i] == "") {
+			t.Errorf("path %d: got %q, want %q", i, value, want[i])
+		}
+	}
+
+	for _, doc := range []string{`{"id": 1`, `{"id": "1}`, `{"user": {"name": [}`} {
+		if _, err := pointers.Extract([]byte(doc)); err == nil {
+			t.Errorf("%s: extracted", doc)
+		}
+	}
+}
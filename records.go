@@ -0,0 +1,109 @@
+package s3filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Records reads the JSON values of src one at a time, returning each raw value with its byte offset, and io.EOF at the end.
+// Values are delimited by the decoder rather than by newlines, so pretty-printed objects spanning multiple lines are read as well.
+func Records(src io.Reader) func() (json.RawMessage, int64, error) {
+	decoder := json.NewDecoder(src)
+	return func() (json.RawMessage, int64, error) {
+		offset := decoder.InputOffset()
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		return raw, offset, err
+	}
+}
+
+// DecodeValue decodes raw JSON into untyped values, keeping numbers as json.Number so large
+// ids and high-precision decimals round-trip exactly instead of becoming float64
+func DecodeValue(raw []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// NumberValue parses a json.Number exactly, for comparisons
+func NumberValue(n json.Number) (*big.Float, bool) {
+	f, _, err := big.ParseFloat(string(n), 10, 256, big.ToNearestEven)
+	return f, err == nil
+}
+
+// CheckObject describes why a raw JSON value can't be a record: it is not an object, or repeats a top-level key
+func CheckObject(raw []byte) error {
+	value := bytes.TrimLeft(raw, " \t\r\n")
+	if len(value) == 0 || value[0] != '{' {
+		return fmt.Errorf("not a JSON object but %s", jsonKind(value))
+	}
+	if key, dup := duplicateKey(value); dup {
+		return fmt.Errorf("duplicate key %s", key)
+	}
+	return nil
+}
+
+// Name the kind of a non-object JSON value
+func jsonKind(value []byte) string {
+	switch {
+	case len(value) == 0:
+		return "nothing"
+	case value[0] == '[':
+		return "an array"
+	case value[0] == '"':
+		return "a string"
+	case value[0] == 't' || value[0] == 'f':
+		return "a boolean"
+	case value[0] == 'n':
+		return "null"
+	}
+	return "a number"
+}
+
+// Find the first repeated top-level key of a JSON object in one pass, without decoding values
+func duplicateKey(object []byte) (string, bool) {
+	seen := make(map[string]bool)
+	depth, inString, escaped, expectKey := 0, false, false, false
+	start := 0
+	for i, c := range object {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if start > 0 {
+					key := string(object[start-1 : i+1])
+					if seen[key] {
+						return key, true
+					}
+					seen[key] = true
+					start = 0
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+			if depth == 1 && expectKey {
+				start = i + 1
+				expectKey = false
+			}
+		case '{', '[':
+			depth++
+			expectKey = depth == 1 && c == '{'
+		case '}', ']':
+			depth--
+		case ',':
+			expectKey = depth == 1
+		}
+	}
+	return "", false
+}
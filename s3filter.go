@@ -1,196 +1,187 @@
-package main
+// Package s3filter filters NDJSON records stored in S3.
+//
+// It provides the pieces the s3filter command is built from: S3 URI parsing, downloads and streaming reads that resume
+// stalled transfers (Transfer), guarded decompression of gzip, zstd and bzip2 objects detected by their magic bytes,
+// text decoding, and record matching by criteria and by conditions on any field (Where).
+//
+//	bucket, key, _ := s3filter.ParseURI("s3://logs/2023/01/18.json.gz")
+//	data, _ := s3filter.Download(ctx, sess, bucket, key)
+//	src, _ := s3filter.Decompress(bytes.NewReader(data), key, s3filter.Limits{})
+//	err := s3filter.Filter(src, s3filter.Criteria{Word: "error"}, func(r s3filter.Record) error { ... })
+package s3filter
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"io"
-	"os"
-	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"golang.org/x/exp/slices"
 )
 
+// Record is one NDJSON document
 type Record struct {
 	Id    int64     `json:"id"`
 	Time  time.Time `json:"time"`
 	Words []string  `json:"words"`
+
+	// Raw is the whole document as read, including the fields Record has no place for
+	Raw json.RawMessage `json:"-"`
 }
 
-// Arguments variables
-var (
-	S3URI    *string
-	WithID   *int64
-	FromTime time.Time
-	ToTime   time.Time
-	WithWord *string
-)
+// The fields of a document Decode reads
+var recordFields = NewPointers([][]string{{"id"}, {"time"}, {"words"}})
 
-/*
-| Name | Required | Description |
-| ---- | -------- | ----------- |
-| `-input` | Yes | An S3 URI (`s3://{bucket}/{key}`) that refers to the source object to be filtered. |
-| `-with-id` | No | An integer that contains the `id` of a JSON object to be selected. |
-| `-from-time` | No | An RFC3339 timestamp that represents the earliest `time` of a JSON object to be selected. |
-| `-to-time` | No | An RFC3339 timestamp that represents the latest `time` of JSON object to be selected. |
-| `-with-word` | No | A string containing a word that must be contained in `words` of a JSON objec to be selected. |
-*/
-func processArgs() {
-	S3URI = flag.String("input", "", "An S3 URI (`s3://{bucket}/{key}`) that refers to the source object to be filtered.")
-	WithID = flag.Int64("with-id", 0, "An integer that contains the `id` of a JSON object to be selected.")
-	WithWord = flag.String("with-word", "", "A string containing a word that must be contained in `words` of a JSON objec to be selected.")
-	fromTime := flag.String("from-time", "", "An RFC3339 timestamp that represents the earliest `time` of a JSON object to be selected.")
-	toTime := flag.String("to-time", "", "An RFC3339 timestamp that represents the latest `time` of JSON object to be selected.")
-	flag.Parse()
-
-	//`-input` flag is missing then print usage message
-	if *S3URI == "" {
-		fmt.Println("| Name | Required | Description |")
-		fmt.Println("| ---- | -------- | ----------- |")
-		fmt.Println("| `-input` | Yes | An S3 URI (`s3://{bucket}/{key}`) that refers to the source object to be filtered. |")
-		fmt.Println("| `-with-id` | No | An integer that contains the `id` of a JSON object to be selected. |")
-		fmt.Println("| `-from-time` | No | An RFC3339 timestamp that represents the earliest `time` of a JSON object to be selected. |")
-		fmt.Println("| `-to-time` | No | An RFC3339 timestamp that represents the latest `time` of JSON object to be selected. |")
-		fmt.Println("| `-with-word` | No | A string containing a word that must be contained in `words` of a JSON objec to be selected. |")
-		fmt.Println("Docker Command:")
-		fmt.Println("docker run --rm -e AWS_REGION -e AWS_ACCESS_KEY_ID -e AWS_SECRET_ACCESS_KEY s3filter -input s3://maf-sample-data/1k.ndjson.gz -from-time=2000-01-01T00:00:00Z -to-time=2001-01-01T00:00:00Z")
-		os.Exit(1)
+// Decode reads a record from a JSON object.
+// The `id`, `time` and `words` fields are left unset when they are missing or of another type, so documents of any schema decode.
+// Only those fields are decoded; the rest of the document is checked to be valid JSON and skipped.
+func Decode(raw []byte) (Record, error) {
+	if !json.Valid(raw) {
+		// for the syntax error
+		return Record{}, json.Unmarshal(raw, new(json.RawMessage))
 	}
-
-	var err error
-	if *fromTime != "" {
-		FromTime, err = time.Parse(time.RFC3339, *fromTime)
-		if err != nil {
-			fmt.Println("Error while parsing the time :", err)
-		}
+	if value := bytes.TrimLeft(raw, " \t\r\n"); value[0] != '{' {
+		return Record{}, fmt.Errorf("not a JSON object but %s", jsonKind(value))
 	}
-
-	if *toTime != "" {
-		ToTime, err = time.Parse(time.RFC3339, *toTime)
-		if err != nil {
-			fmt.Println("Error while parsing the time :", err)
-		}
+	fields, err := recordFields.Extract(raw)
+	if err != nil {
+		return Record{}, err
+	}
+	record := Record{Raw: raw}
+	if json.Unmarshal(fields[0], &record.Id) != nil {
+		record.Id = 0
+	}
+	if json.Unmarshal(fields[1], &record.Time) != nil {
+		record.Time = time.Time{}
+	}
+	if json.Unmarshal(fields[2], &record.Words) != nil {
+		record.Words = nil
 	}
+	return record, nil
 }
 
-// parse bytes array to ndJson and filter based on criteria
-func filter(src []byte) error {
-	decorder := json.NewDecoder(bytes.NewReader(src))
-	for {
-		// Decode one JSON document.
-		var record Record
-		err := decorder.Decode(&record)
+// Criteria select records; zero fields match everything
+type Criteria struct {
+	ID   int64     // the record `id`
+	From time.Time // the earliest record `time`
+	To   time.Time // the latest record `time`
+	Word string    // a word the record's `words` must contain
 
-		if err != nil {
-			// io.EOF is expected at end of stream.
-			if err != io.EOF {
-				return err
-			}
-			break
-		}
+	WordPattern Matcher // a pattern (or *PatternSet) one of the record's `words` must match
 
-		// Filter
-		if *WithID != 0 && *WithID != record.Id {
-			continue
-		}
+	Words   []string // more words the record's `words` must contain
+	AnyWord bool     // one of Words is enough, rather than all of them
 
-		if !FromTime.IsZero() && record.Time.Before(FromTime) {
-			continue
-		}
+	WithoutWords []string // words that exclude a record whose `words` contain any of them
 
-		if !ToTime.IsZero() && record.Time.After(ToTime) {
-			continue
-		}
+	IDs map[int64]bool // ids one of which the record `id` must be
+}
 
-		if *WithWord != "" && !slices.Contains(record.Words, *WithWord) {
-			continue
-		}
+// Matches reports whether the record meets every criterion
+func (c Criteria) Matches(record Record) bool {
+	return c.matchesID(record.Id) && c.matchesTime(record.Time) && c.matchesWords(record.Words)
+}
 
-		//print struct as json string
-		s, err := json.Marshal(record)
-		if err == nil {
-			fmt.Println(string(s))
-		}
+func (c Criteria) matchesID(id int64) bool {
+	if c.ID != 0 && c.ID != id {
+		return false
 	}
-	return nil
+
+	if len(c.IDs) > 0 && !c.IDs[id] {
+		return false
+	}
+
+	return true
 }
 
-// Extract *.gz file in the same directory
-func gzUnzip(gzBytes []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(gzBytes))
-	if err != nil {
-		return nil, err
+func (c Criteria) matchesTime(t time.Time) bool {
+	if !c.From.IsZero() && t.Before(c.From) {
+		return false
 	}
-	defer reader.Close()
 
-	buf := new(bytes.Buffer)
-	if _, err = io.Copy(buf, reader); err != nil {
-		return nil, err
+	if !c.To.IsZero() && t.After(c.To) {
+		return false
 	}
 
-	return buf.Bytes(), nil
+	return true
 }
 
-// Print error messages and exit application
-func exitErrorf(msg string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, msg+"\n", args...)
-	os.Exit(1)
-}
+func (c Criteria) matchesWords(words []string) bool {
+	if c.Word != "" && !slices.Contains(words, c.Word) {
+		return false
+	}
 
-func main() {
+	if c.WordPattern != nil && !slices.ContainsFunc(words, c.WordPattern.MatchString) {
+		return false
+	}
 
-	//parse arguments
-	processArgs()
+	if len(c.Words) > 0 {
+		contains := func(word string) bool { return slices.Contains(words, word) }
+		if c.AnyWord && !slices.ContainsFunc(c.Words, contains) {
+			return false
+		}
+		if !c.AnyWord && slices.IndexFunc(c.Words, func(word string) bool { return !contains(word) }) >= 0 {
+			return false
+		}
+	}
 
-	//parse s3URI for Bucket and Key
-	s3Info := strings.Split((*S3URI)[5:len(*S3URI)], "/")
-	if len(s3Info) != 2 {
-		exitErrorf("Failed to parse S3 URI %q \n", *S3URI)
+	for _, word := range c.WithoutWords {
+		if slices.Contains(words, word) {
+			return false
+		}
 	}
 
-	s3_bucket := s3Info[0]
-	s3_key := s3Info[1]
+	return true
+}
 
-	// Create Session
-	sess, err := session.NewSession()
-	if err != nil {
-		exitErrorf("Failed to create new session. %v\n", err)
-		return
-	}
+// Options refine what FilterWith selects and how it handles values that aren't usable records
+type Options struct {
+	Where *Where // conditions on any field of the document, met by every selected record
 
-	//Create a downloader with the session and custom options
-	downloader := s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
-		d.PartSize = 64 * 1024 * 1024 //64MB per part
-		d.Concurrency = 6
-	})
+	// Malformed is given each value of src that is valid JSON but not a usable record (see CheckObject),
+	// with its 1-based index and byte offset, and skips it unless it returns an error.
+	// Without it, the first such value stops the filter.
+	Malformed func(index int64, offset int64, raw json.RawMessage, err error) error
+}
 
-	//download file from AWS S3 to memory
-	buff := &aws.WriteAtBuffer{}
-	_, err = downloader.Download(buff, &s3.GetObjectInput{
-		Bucket: aws.String(s3_bucket),
-		Key:    aws.String(s3_key),
-	})
+// Filter decodes NDJSON records from src and passes those matching the criteria to emit.
+// It stops at the first decoding error, value that isn't a JSON object, or error returned by emit.
+func Filter(src io.Reader, criteria Criteria, emit func(Record) error) error {
+	return FilterWith(src, criteria, Options{}, emit)
+}
 
-	if err != nil {
-		exitErrorf("Unable to download file %v", err)
-	}
+// FilterWith is Filter refined by options
+func FilterWith(src io.Reader, criteria Criteria, options Options, emit func(Record) error) error {
+	next := Records(src)
+	for index := int64(1); ; index++ {
+		raw, offset, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("record %d at offset %d: %w", index, offset, err)
+		}
 
-	//Extract *.gz
-	ndJsonBytes, err := gzUnzip(buff.Bytes())
-	if err != nil {
-		exitErrorf("Unable to unzip file %v", err)
-	}
+		var record Record
+		if err = CheckObject(raw); err == nil {
+			record, err = Decode(raw)
+		}
+		if err != nil {
+			if options.Malformed == nil {
+				return fmt.Errorf("record %d at offset %d: %w", index, offset, err)
+			}
+			if err = options.Malformed(index, offset, raw, err); err != nil {
+				return err
+			}
+			continue
+		}
 
-	//Decode ndjson from bytes and print record that matches with criteria
-	err = filter(ndJsonBytes)
-	if err != nil {
-		exitErrorf("Unable to decode ndJson file %v", err)
+		if !criteria.Matches(record) || !options.Where.Matches(raw) {
+			continue
+		}
+		if err := emit(record); err != nil {
+			return err
+		}
 	}
 }
@@ -0,0 +1,195 @@
+package s3filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	for _, test := range []struct {
+		doc   string
+		id    int64
+		time  string
+		words int
+	}{
+		{`{"id": 7, "time": "2024-01-02T03:04:05Z", "words": ["a", "b"]}`, 7, "2024-01-02T03:04:05Z", 2},
+		{`{"id": "7", "time": 12, "words": "a"}`, 0, "", 0},
+		{`{"other": {"id": 7}}`, 0, "", 0},
+		{`{"id": 1, "words": ["a"], "id": 2, "words": null}`, 2, "", 0},
+		{`{"\u0069d": 3, "meta": {"time": "x", "words": [1]}, "tail": [{"id": 4}]}`, 3, "", 0},
+	} {
+		record, err := Decode([]byte(test.doc))
+		if err != nil {
+			t.Errorf("%s: %v", test.doc, err)
+			continue
+		}
+		var when time.Time
+		if test.time != "" {
+			when, _ = time.Parse(time.RFC3339, test.time)
+		}
+		if record.Id != test.id || !record.Time.Equal(when) || len(record.Words) != test.words || string(record.Raw) != test.doc {
+			t.Errorf("%s decoded as %+v", test.doc, record)
+		}
+	}
+	for _, doc := range []string{`[1]`, `null`, `{"id": 1`, `{"id" 1}`, `{"id": 1} x`} {
+		if _, err := Decode([]byte(doc)); err == nil {
+			t.Errorf("decoded %s", doc)
+		}
+	}
+}
+
+func TestCriteria(t *testing.T) {
+	record := Record{Id: 5, Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Words: []string{"disk", "error"}}
+	for i, test := range []struct {
+		criteria Criteria
+		want     bool
+	}{
+		{Criteria{}, true},
+		{Criteria{ID: 5}, true},
+		{Criteria{ID: 6}, false},
+		{Criteria{IDs: map[int64]bool{4: true, 5: true}}, true},
+		{Criteria{IDs: map[int64]bool{4: true}}, false},
+		{Criteria{From: record.Time, To: record.Time}, true},
+		{Criteria{From: record.Time.Add(time.Second)}, false},
+		{Criteria{To: record.Time.Add(-time.Second)}, false},
+		{Criteria{Word: "error"}, true},
+		{Criteria{Word: "warn"}, false},
+		{Criteria{Words: []string{"disk", "error"}}, true},
+		{Criteria{Words: []string{"disk", "warn"}}, false},
+		{Criteria{Words: []string{"disk", "warn"}, AnyWord: true}, true},
+		{Criteria{WithoutWords: []string{"warn"}}, true},
+		{Criteria{WithoutWords: []string{"disk"}}, false},
+	} {
+		if got := test.criteria.Matches(record); got != test.want {
+			t.Errorf("%d: %+v matched %v, want %v", i, test.criteria, got, test.want)
+		}
+	}
+}
+
+// The ids of the records emitted by FilterWith
+func filtered(src string, criteria Criteria, options Options) ([]int64, error) {
+	var ids []int64
+	err := FilterWith(strings.NewReader(src), criteria, options, func(r Record) error {
+		ids = append(ids, r.Id)
+		return nil
+	})
+	return ids, err
+}
+
+func TestFilter(t *testing.T) {
+	src := `{"id": 1, "words": ["error"]}
+{"id": 2, "words": ["info"]}
+{
+  "id": 3,
+  "words": ["error", "disk"]
+}
+`
+	var ids []int64
+	err := Filter(strings.NewReader(src), Criteria{Word: "error"}, func(r Record) error {
+		ids = append(ids, r.Id)
+		return nil
+	})
+	if err != nil || fmt.Sprint(ids) != "[1 3]" {
+		t.Errorf("got %v, %v, want records 1 and 3", ids, err)
+	}
+
+	stop := errors.New("stop")
+	err = Filter(strings.NewReader(src), Criteria{}, func(r Record) error { return stop })
+	if err != stop {
+		t.Errorf("got %v, want the error of emit", err)
+	}
+	err = Filter(strings.NewReader(src+`{"id": 4`), Criteria{}, func(r Record) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "record 4 at offset") {
+		t.Errorf("got %v, want record 4 to be truncated", err)
+	}
+}
+
+func TestFilterMalformed(t *testing.T) {
+	src := `{"id": 1}
+[2]
+{"id": 3, "id": 4}
+"text"
+{"id": 5}
+`
+	if _, err := filtered(src, Criteria{}, Options{}); err == nil || !strings.Contains(err.Error(), "record 2 at offset 9: not a JSON object but an array") {
+		t.Errorf("got %v, want record 2 to stop the filter", err)
+	}
+
+	var malformed []string
+	ids, err := filtered(src, Criteria{}, Options{Malformed: func(index int64, offset int64, raw json.RawMessage, err error) error {
+		malformed = append(malformed, fmt.Sprintf("%d@%d %s: %v", index, offset, raw, err))
+		return nil
+	}})
+	want := []string{
+		`2@9 [2]: not a JSON object but an array`,
+		`3@13 {"id": 3, "id": 4}: duplicate key "id"`,
+		`4@32 "text": not a JSON object but a string`,
+	}
+	if err != nil || fmt.Sprint(ids) != "[1 5]" || fmt.Sprint(malformed) != fmt.Sprint(want) {
+		t.Errorf("got %v, %q, %v, want records 1 and 5 with %q skipped", ids, malformed, err, want)
+	}
+
+	stop := errors.New("too many")
+	_, err = filtered(src, Criteria{}, Options{Malformed: func(int64, int64, json.RawMessage, error) error { return stop }})
+	if err != stop {
+		t.Errorf("got %v, want the error of Malformed", err)
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	src := `{"id": 1, "user": {"country": "DE"}, "words": ["error"]}
+{"id": 2, "user": {"country": "FR"}, "words": ["error"]}
+{"id": 3, "user": {"country": "DE"}, "words": ["info"]}
+`
+	condition, err := ParseCondition("user.country=DE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := filtered(src, Criteria{Word: "error"}, Options{Where: NewWhere(condition)})
+	if err != nil || fmt.Sprint(ids) != "[1]" {
+		t.Errorf("got %v, %v, want record 1", ids, err)
+	}
+}
+
+// Offsets are those the decoder reached after the previous value, so they include the whitespace before a value
+func TestRecords(t *testing.T) {
+	next := Records(strings.NewReader("{\"a\": 1}\n  [1,\n 2] \"x\"\n"))
+	var got []string
+	for {
+		raw, offset, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d:%s", offset, raw))
+	}
+	if want := "[0:{\"a\": 1} 8:[1,\n 2] 18:\"x\"]"; fmt.Sprint(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCheckObject(t *testing.T) {
+	for doc, want := range map[string]string{
+		`{"a": 1, "b": {"a": 2}, "c": [{"a": 3}]}`: "",
+		`{"a": "\"a\"", "b": 1}`:                   "",
+		` {"a": 1, "b": 2, "a": 3}`:                `duplicate key "a"`,
+		`[]`:                                       "not a JSON object but an array",
+		`"{}"`:                                     "not a JSON object but a string",
+		`false`:                                    "not a JSON object but a boolean",
+		`null`:                                     "not a JSON object but null",
+		`-1`:                                       "not a JSON object but a number",
+		``:                                         "not a JSON object but nothing",
+	} {
+		err := CheckObject([]byte(doc))
+		if got := fmt.Sprint(err); want == "" && err != nil || want != "" && got != want {
+			t.Errorf("%s: got %v, want %q", doc, err, want)
+		}
+	}
+}
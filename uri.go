@@ -0,0 +1,55 @@
+package s3filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseURI splits an S3 URI (`s3://{bucket}/{key}`) into bucket and key
+func ParseURI(uri string) (string, string, error) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return "", "", fmt.Errorf("failed to parse S3 URI %q", uri)
+	}
+
+	bucket, key, ok := cutBucket(strings.TrimPrefix(uri, "s3://"))
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("failed to parse S3 URI %q", uri)
+	}
+	return bucket, key, nil
+}
+
+// ParsePrefix splits an S3 prefix URI (`s3://{bucket}/{prefix}`) into bucket and prefix, which may be empty
+func ParsePrefix(uri string) (string, string, error) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return "", "", fmt.Errorf("failed to parse S3 URI %q", uri)
+	}
+
+	bucket, prefix, _ := cutBucket(strings.TrimPrefix(uri, "s3://"))
+	if bucket == "" {
+		return "", "", fmt.Errorf("failed to parse S3 URI %q", uri)
+	}
+	return bucket, prefix, nil
+}
+
+// Split the bucket off the rest of an S3 URI.
+// The bucket may be an access point ARN in any partition (`arn:aws-us-gov:s3:us-gov-west-1:{account}:accesspoint/{name}`),
+// or an Object Lambda access point ARN (`arn:aws:s3-object-lambda:{region}:{account}:accesspoint/{name}`), which contains a `/` itself.
+func cutBucket(rest string) (string, string, bool) {
+	if !strings.HasPrefix(rest, "arn:") {
+		return strings.Cut(rest, "/")
+	}
+	resource, key, ok := strings.Cut(rest, "/")
+	name, key, ok := strings.Cut(key, "/")
+	if name == "" {
+		return rest, "", false
+	}
+	return resource + "/" + name, key, ok
+}
+
+// IsObjectLambda reports whether a bucket is an Object Lambda access point ARN.
+// Its objects are transformed by a Lambda function as they are read, so they are read whole in a single GET:
+// their transformed size is unknown and ranged reads return parts of the untransformed object, if they are supported at all.
+func IsObjectLambda(bucket string) bool {
+	parts := strings.SplitN(bucket, ":", 4)
+	return len(parts) == 4 && parts[0] == "arn" && parts[2] == "s3-object-lambda"
+}
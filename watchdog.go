@@ -0,0 +1,114 @@
+package s3filter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStalled fails the read of a transfer that received no bytes for its StallTimeout
+var ErrStalled = errors.New("transfer stalled")
+
+// Watchdog cancelling a transfer that received no bytes for its stall timeout.
+// The clock is paused while the reader holds the received bytes, so a slow consumer doesn't look like a stall.
+type watchdog struct {
+	last    int64 // unix nanoseconds of the latest received bytes
+	paused  int32
+	stalled int32
+	done    chan struct{}
+}
+
+// Start watching; returns nil when stall detection is disabled
+func watch(timeout time.Duration, cancel context.CancelFunc) *watchdog {
+	if timeout <= 0 {
+		return nil
+	}
+
+	w := &watchdog{last: time.Now().UnixNano(), done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if atomic.LoadInt32(&w.paused) == 0 && time.Since(time.Unix(0, atomic.LoadInt64(&w.last))) > timeout {
+					atomic.StoreInt32(&w.stalled, 1)
+					cancel()
+					return
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// Note that bytes arrived, or are being waited for again, restarting the clock
+func (w *watchdog) touch() {
+	if w != nil {
+		atomic.StoreInt64(&w.last, time.Now().UnixNano())
+		atomic.StoreInt32(&w.paused, 0)
+	}
+}
+
+// Stop the clock until the next touch, while nothing is waiting for bytes
+func (w *watchdog) pause() {
+	if w != nil {
+		atomic.StoreInt32(&w.paused, 1)
+	}
+}
+
+// Stop watching and translate the transfer error
+func (w *watchdog) stop(err error) error {
+	if w == nil {
+		return err
+	}
+	close(w.done)
+	if err != nil && atomic.LoadInt32(&w.stalled) == 1 {
+		return ErrStalled
+	}
+	return err
+}
+
+// Reader feeding the watchdog, releasing it when the stream ends
+type watchedReader struct {
+	r      io.ReadCloser
+	wd     *watchdog
+	cancel context.CancelFunc
+}
+
+func (w *watchedReader) Read(b []byte) (int, error) {
+	// only the time spent waiting on the network counts
+	w.wd.touch()
+	n, err := w.r.Read(b)
+	w.wd.pause()
+	if err != nil && err != io.EOF {
+		err = w.wd.stop(err)
+		w.wd = nil
+	}
+	return n, err
+}
+
+func (w *watchedReader) Close() error {
+	w.wd.stop(nil)
+	w.wd = nil
+	w.cancel()
+	return w.r.Close()
+}
+
+// Watch opens a stream with open, within the transfer's Timeout, and fails the read waiting on it with ErrStalled
+// once it has received no bytes for StallTimeout. The context open is given is cancelled when the stream is closed.
+func (t Transfer) Watch(ctx context.Context, open func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	ctx, cancel := t.context(ctx)
+	wd := watch(t.StallTimeout, cancel)
+	r, err := open(ctx)
+	if err != nil {
+		cancel()
+		return nil, wd.stop(err)
+	}
+	wd.pause()
+	return &watchedReader{r: r, wd: wd, cancel: cancel}, nil
+}
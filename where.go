@@ -0,0 +1,99 @@
+package s3filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Condition is a test of one field of a document, e.g. `user.country=DE`
+type Condition struct {
+	path   []string
+	value  string
+	negate bool
+}
+
+// ParseCondition parses `{path}={value}` or `{path}!={value}`, the path naming nested fields with dots or as a JSON pointer (`/user/country`)
+func ParseCondition(expr string) (Condition, error) {
+	var c Condition
+	field, value, ok := strings.Cut(expr, "!=")
+	if ok {
+		c.negate = true
+	} else if field, value, ok = strings.Cut(expr, "="); !ok {
+		return c, fmt.Errorf("%q is not `{field}={value}` or `{field}!={value}`", expr)
+	}
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return c, fmt.Errorf("%q names no field", expr)
+	}
+	if strings.HasPrefix(field, "/") {
+		c.path = ParsePointer(field)
+	} else {
+		c.path = strings.Split(field, ".")
+	}
+	c.value = strings.TrimSpace(value)
+	return c, nil
+}
+
+// Where is a set of conditions a document must all meet. A nil *Where is met by every document.
+type Where struct {
+	conditions []Condition
+	pointers   *Pointers
+}
+
+// NewWhere combines conditions, extracting the fields they test from each document in one pass
+func NewWhere(conditions ...Condition) *Where {
+	paths := make([][]string, len(conditions))
+	for i, c := range conditions {
+		paths[i] = c.path
+	}
+	return &Where{conditions: conditions, pointers: NewPointers(paths)}
+}
+
+// Matches reports whether a document meets every condition.
+// Only the fields the conditions name are decoded, so the cost doesn't grow with the rest of the document.
+// A field holding an array matches when one of its elements does; a missing field only meets `!=`.
+func (w *Where) Matches(doc []byte) bool {
+	if w == nil || len(w.conditions) == 0 {
+		return true
+	}
+	values, err := w.pointers.Extract(doc)
+	if err != nil {
+		return false
+	}
+	for i, c := range w.conditions {
+		var value interface{}
+		found := values[i] != nil
+		if found && DecodeValue(values[i], &value) != nil {
+			return false
+		}
+		if (found && equalText(value, c.value)) == c.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare a JSON value with the text of a condition: strings as is, numbers by value, `true`, `false` and `null` literally
+func equalText(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == want
+	case json.Number:
+		got, ok := NumberValue(v)
+		expected, valid := NumberValue(json.Number(want))
+		return ok && valid && got.Cmp(expected) == 0
+	case bool:
+		return strconv.FormatBool(v) == want
+	case nil:
+		return want == "null"
+	case []interface{}:
+		for _, item := range v {
+			if equalText(item, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
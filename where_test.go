@@ -0,0 +1,50 @@
+package s3filter
+
+import "testing"
+
+func TestWhere(t *testing.T) {
+	doc := []byte(`{"id": 150, "ratio": 2.50, "ok": true, "none": null, "user": {"country": "DE", "a/b": "x"}, "tags": ["red", "blue"]}`)
+	for _, test := range []struct {
+		conditions []string
+		want       bool
+	}{
+		{nil, true},
+		{[]string{"user.country=DE"}, true},
+		{[]string{"user.country = DE "}, true},
+		{[]string{"user.country!=DE"}, false},
+		{[]string{"/user/country=DE"}, true},
+		{[]string{"/user/a~1b=x"}, true},
+		{[]string{"id=150", "user.country=FR"}, false},
+		{[]string{"id=150.0", "ratio=2.5", "ok=true", "none=null"}, true},
+		{[]string{"id=15"}, false},
+		{[]string{"tags=blue"}, true},
+		{[]string{"tags!=green"}, true},
+		{[]string{"user.zip=1"}, false},
+		{[]string{"user.zip!=1"}, true},
+		{[]string{"user=DE"}, false},
+	} {
+		var conditions []Condition
+		for _, expr := range test.conditions {
+			c, err := ParseCondition(expr)
+			if err != nil {
+				t.Fatalf("%s: %v", expr, err)
+			}
+			conditions = append(conditions, c)
+		}
+		if got := NewWhere(conditions...).Matches(doc); got != test.want {
+			t.Errorf("%q matched %v, want %v", test.conditions, got, test.want)
+		}
+	}
+	var none *Where
+	if !none.Matches(doc) {
+		t.Error("a nil Where didn't match")
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	for _, expr := range []string{"", "country", "=DE", " != DE"} {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Errorf("%q parsed", expr)
+		}
+	}
+}